@@ -0,0 +1,99 @@
+package poh
+
+import (
+	"sync"
+	"time"
+)
+
+const DefaultAutoscalerScaleUpWait = 10 * time.Millisecond
+const DefaultAutoscalerScaleUpUtilization = 0.8
+const DefaultAutoscalerScaleDownUtilization = 0.3
+const DefaultAutoscalerScaleDownAfter = 5
+
+// Autoscaler - computes target count of open connections between Min and Max by pool stats;
+// pool opens connections up to target and closes idle connections over target (see ConnectionPool.Autoscaler)
+// target grows when callers waited longer than ScaleUpWait or utilization is ScaleUpUtilization or more;
+// target shrinks after ScaleDownAfter consecutive observations with utilization ScaleDownUtilization or less
+type Autoscaler struct {
+	Min int
+	Max int
+	// Step - change of target by one observation (0 - 1)
+	Step int
+
+	// ScaleUpWait - average wait of GetWait callers between observations that grows target
+	ScaleUpWait time.Duration
+	// ScaleUpUtilization - (in use + waiters) / target that grows target
+	ScaleUpUtilization float64
+	// ScaleDownUtilization - (in use + waiters) / target that shrinks target (should be less than ScaleUpUtilization)
+	ScaleDownUtilization float64
+	// ScaleDownAfter - count of consecutive low utilization observations that shrinks target
+	ScaleDownAfter int
+
+	target    int
+	lowCount  int
+	waitCount int64
+	waitDur   time.Duration
+
+	mx sync.Mutex
+}
+
+func MakeAutoscaler(min int, max int) *Autoscaler {
+	return &Autoscaler{
+		Min: min,
+		Max: max,
+
+		ScaleUpWait:          DefaultAutoscalerScaleUpWait,
+		ScaleUpUtilization:   DefaultAutoscalerScaleUpUtilization,
+		ScaleDownUtilization: DefaultAutoscalerScaleDownUtilization,
+		ScaleDownAfter:       DefaultAutoscalerScaleDownAfter,
+
+		target: min,
+	}
+}
+
+// Observe - adjusts target by pool stats and returns it
+func (a *Autoscaler) Observe(s ConnectionPoolStats) (target int) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	var avgWait time.Duration
+	if dCount := s.WaitCount - a.waitCount; dCount > 0 {
+		avgWait = (s.WaitDuration - a.waitDur) / time.Duration(dCount)
+	}
+	a.waitCount = s.WaitCount
+	a.waitDur = s.WaitDuration
+
+	busy := float64(s.InUse + s.Waiters)
+	utilization := busy / float64(max(a.target, 1))
+	if a.target == 0 && busy == 0 {
+		utilization = 0
+	}
+
+	step := max(a.Step, 1)
+
+	switch {
+	case s.Waiters > 0 || avgWait > 0 && avgWait >= a.ScaleUpWait || utilization >= a.ScaleUpUtilization:
+		a.lowCount = 0
+		a.target += step
+	case utilization <= a.ScaleDownUtilization:
+		a.lowCount++
+		if a.lowCount >= max(a.ScaleDownAfter, 1) {
+			a.lowCount = 0
+			a.target -= step
+		}
+	default:
+		a.lowCount = 0
+	}
+
+	a.target = min(max(a.target, a.Min), a.Max)
+
+	return a.target
+}
+
+// Target - returns current target count of open connections
+func (a *Autoscaler) Target() int {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	return min(max(a.target, a.Min), a.Max)
+}
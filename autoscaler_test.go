@@ -0,0 +1,77 @@
+package poh
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAutoscalerObserve(t *testing.T) {
+	a := MakeAutoscaler(1, 4)
+	a.ScaleDownAfter = 2
+
+	if target := a.Observe(ConnectionPoolStats{InUse: 1}); target != 2 {
+		t.Errorf("target should grow by utilization to 2 but `%v`", target)
+	}
+	if target := a.Observe(ConnectionPoolStats{InUse: 1, Waiters: 3}); target != 3 {
+		t.Errorf("target should grow by waiters to 3 but `%v`", target)
+	}
+	if target := a.Observe(ConnectionPoolStats{InUse: 1, WaitCount: 2, WaitDuration: time.Second}); target != 4 {
+		t.Errorf("target should grow by wait time to 4 but `%v`", target)
+	}
+	if target := a.Observe(ConnectionPoolStats{InUse: 4, WaitCount: 2, WaitDuration: time.Second}); target != 4 {
+		t.Errorf("target should be limited by max 4 but `%v`", target)
+	}
+
+	// hysteresis: medium utilization keeps target, low utilization shrinks it only after ScaleDownAfter observations
+	if target := a.Observe(ConnectionPoolStats{InUse: 2, WaitCount: 2, WaitDuration: time.Second}); target != 4 {
+		t.Errorf("target should stay 4 but `%v`", target)
+	}
+	if target := a.Observe(ConnectionPoolStats{WaitCount: 2, WaitDuration: time.Second}); target != 4 {
+		t.Errorf("target should stay 4 after first low observation but `%v`", target)
+	}
+	if target := a.Observe(ConnectionPoolStats{WaitCount: 2, WaitDuration: time.Second}); target != 3 {
+		t.Errorf("target should shrink to 3 but `%v`", target)
+	}
+
+	for i := 0; i < 10; i++ {
+		a.Observe(ConnectionPoolStats{WaitCount: 2, WaitDuration: time.Second})
+	}
+	if target := a.Target(); target != 1 {
+		t.Errorf("target should be limited by min 1 but `%v`", target)
+	}
+}
+
+func TestConnectionPoolAutoscale(t *testing.T) {
+	cp := makeTestWaitPool(10)
+	cp.Autoscaler = MakeAutoscaler(1, 5)
+	cp.Autoscaler.ScaleDownAfter = 1
+
+	cp.ClearAndOpenJobStep()
+	if s := cp.Stats(); s.OpenConnections != 1 {
+		t.Fatalf("pool should be opened to autoscaler min: %v", ToJson(s))
+	}
+
+	_, free1, _ := cp.Get(context.Background())
+	_, free2, _ := cp.Get(context.Background())
+	_, free3, _ := cp.Get(context.Background())
+
+	// target grows by step until utilization is below ScaleUpUtilization (3 / 4)
+	for i := 0; i < 5; i++ {
+		cp.ClearAndOpenJobStep()
+	}
+	if s := cp.Stats(); s.OpenConnections != 4 || s.Idle != 1 {
+		t.Fatalf("pool should pre-open connection by demand: %v", ToJson(s))
+	}
+
+	free1()
+	free2()
+	free3()
+
+	for i := 0; i < 10; i++ {
+		cp.ClearAndOpenJobStep()
+	}
+	if s := cp.Stats(); s.OpenConnections != 1 {
+		t.Fatalf("pool should close idle surplus: %v", ToJson(s))
+	}
+}
@@ -0,0 +1,190 @@
+package poh
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const DefaultBreakerFailureThreshold = 5
+const DefaultBreakerBackoffBase = 100 * time.Millisecond
+const DefaultBreakerBackoffMax = 30 * time.Second
+const DefaultBreakerJitter = 0.2
+
+type BreakerState int
+
+const (
+	// BreakerClosed - calls are allowed
+	BreakerClosed BreakerState = iota
+	// BreakerOpen - calls fail fast until backoff passed
+	BreakerOpen
+	// BreakerHalfOpen - limited probe calls are allowed
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker - opens after FailureThreshold consecutive failures;
+// while open calls fail fast, after backoff it allows HalfOpenProbes probe calls;
+// failed probe opens breaker again with doubled backoff (up to BackoffMax)
+type CircuitBreaker struct {
+	FailureThreshold int
+	BackoffBase      time.Duration
+	BackoffMax       time.Duration
+	// Jitter - random deviation of backoff as part of backoff (0.2 means +-20%)
+	Jitter float64
+	// HalfOpenProbes - count of probe calls allowed at the same time in half-open state
+	HalfOpenProbes int
+	// Clock - source of time (nil - SystemClock)
+	Clock Clock
+
+	state     BreakerState
+	failures  int
+	opens     int
+	probes    int
+	openUntil time.Time
+
+	mx sync.Mutex
+}
+
+// CircuitBreakerStats - snapshot of breaker state
+type CircuitBreakerStats struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenUntil           time.Time `json:"open_until,omitempty"`
+}
+
+func MakeCircuitBreaker(failureThreshold int, backoffBase time.Duration, backoffMax time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		BackoffBase:      backoffBase,
+		BackoffMax:       backoffMax,
+		Jitter:           DefaultBreakerJitter,
+		HalfOpenProbes:   1,
+	}
+}
+
+// Allow - returns ErrBreakerOpen when call is not allowed; allowed call should be finished by Success or Failure
+func (b *CircuitBreaker) Allow() error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.state == BreakerOpen {
+		if b.now().Before(b.openUntil) {
+			return ErrBreakerOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+	}
+
+	if b.state == BreakerHalfOpen {
+		if b.probes >= max(b.HalfOpenProbes, 1) {
+			return ErrBreakerOpen
+		}
+		b.probes++
+	}
+
+	return nil
+}
+
+// Success - closes breaker
+func (b *CircuitBreaker) Success() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.opens = 0
+	b.probes = 0
+}
+
+// Cancel - returns allowed call that was not done
+func (b *CircuitBreaker) Cancel() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// Failure - counts failure and opens breaker when threshold is reached or probe failed
+func (b *CircuitBreaker) Failure() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.failures++
+
+	if b.state == BreakerHalfOpen ||
+		b.state == BreakerClosed && b.failures >= max(b.FailureThreshold, 1) {
+		b.openInternal()
+	}
+}
+
+func (b *CircuitBreaker) openInternal() {
+	b.state = BreakerOpen
+	b.opens++
+	b.probes = 0
+	b.openUntil = b.now().Add(b.backoffInternal())
+}
+
+func (b *CircuitBreaker) now() time.Time {
+	return clockOrSystem(b.Clock).Now()
+}
+
+// backoffInternal - BackoffBase * 2^(opens-1) limited by BackoffMax with jitter
+func (b *CircuitBreaker) backoffInternal() time.Duration {
+	d := b.BackoffBase
+	for i := 1; i < b.opens && (b.BackoffMax <= 0 || d < b.BackoffMax); i++ {
+		d *= 2
+	}
+	if b.BackoffMax > 0 && d > b.BackoffMax {
+		d = b.BackoffMax
+	}
+
+	if b.Jitter > 0 {
+		d += time.Duration(float64(d) * b.Jitter * (rand.Float64()*2 - 1))
+	}
+
+	return d
+}
+
+// State - returns current state (open breaker with passed backoff is reported as half-open)
+func (b *CircuitBreaker) State() BreakerState {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.state == BreakerOpen && !b.now().Before(b.openUntil) {
+		return BreakerHalfOpen
+	}
+
+	return b.state
+}
+
+// Stats - returns snapshot of breaker state
+func (b *CircuitBreaker) Stats() CircuitBreakerStats {
+	state := b.State()
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	res := CircuitBreakerStats{
+		State:               state.String(),
+		ConsecutiveFailures: b.failures,
+	}
+	if state == BreakerOpen {
+		res.OpenUntil = b.openUntil
+	}
+
+	return res
+}
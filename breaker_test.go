@@ -0,0 +1,129 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := MakeCircuitBreaker(2, 5*time.Millisecond, 12*time.Millisecond)
+	b.Jitter = 0
+	clock := fakeclock.New(time.Time{})
+	b.Clock = clock
+
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("call %v should be allowed but `%v`", i, err)
+		}
+		b.Failure()
+	}
+
+	if b.State() != BreakerOpen {
+		t.Fatalf("breaker should be open but `%v`", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("err should be ErrBreakerOpen but `%v`", err)
+	}
+
+	clock.Advance(5 * time.Millisecond)
+
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("breaker should be half-open but `%v`", b.State())
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe should be allowed but `%v`", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("second probe should be rejected but `%v`", err)
+	}
+
+	b.Failure()
+
+	b.mx.Lock()
+	backoff := b.openUntil.Sub(clock.Now())
+	b.mx.Unlock()
+	if backoff != 10*time.Millisecond {
+		t.Errorf("backoff should be doubled but `%v`", backoff)
+	}
+
+	b.mx.Lock()
+	b.opens = 10
+	backoff = b.backoffInternal()
+	b.mx.Unlock()
+	if backoff != 12*time.Millisecond {
+		t.Errorf("backoff should be limited by max but `%v`", backoff)
+	}
+
+	clock.Advance(10 * time.Millisecond)
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe should be allowed but `%v`", err)
+	}
+	b.Success()
+
+	if b.State() != BreakerClosed || b.Stats().ConsecutiveFailures != 0 {
+		t.Errorf("breaker should be closed: %v", ToJson(b.Stats()))
+	}
+}
+
+func TestConnectionPoolBreaker(t *testing.T) {
+	generated := 0
+	fail := true
+	cp := MakeConnectionPool(
+		context.Background(),
+		nil,
+		func(ctxBase context.Context) (*Connection[int], error) {
+			generated++
+			if fail {
+				return nil, fmt.Errorf("test dial error")
+			}
+			return MakeConnection(0,
+				func(ctx context.Context, conn int) error { return nil },
+				nil,
+				nil,
+			), nil
+		},
+		nil,
+		nil,
+	)
+	cp.Breaker = MakeCircuitBreaker(2, 5*time.Millisecond, time.Second)
+	cp.Breaker.Jitter = 0
+	clock := fakeclock.New(time.Time{})
+	cp.Breaker.Clock = clock
+
+	for i := 0; i < 2; i++ {
+		_, _, err := cp.Get(context.Background())
+		if !errors.Is(err, ErrConnectionCreationErrorCP) {
+			t.Errorf("err should be ErrConnectionCreationErrorCP but `%v`", err)
+		}
+	}
+
+	_, _, err := cp.GetWait(context.Background())
+	if !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("err should be ErrBreakerOpen but `%v`", err)
+	}
+	if generated != 2 {
+		t.Errorf("generator should not be called while breaker is open but `%v`", generated)
+	}
+	if s := cp.Stats(); s.Breaker == nil || s.Breaker.State != "open" || s.Creating != 0 {
+		t.Errorf("wrong pool stats: %v", ToJson(s))
+	}
+
+	clock.Advance(5 * time.Millisecond)
+	fail = false
+
+	_, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatalf("probe should create connection but `%v`", err)
+	}
+	free()
+
+	if cp.Breaker.State() != BreakerClosed {
+		t.Errorf("breaker should be closed but `%v`", cp.Breaker.State())
+	}
+}
@@ -0,0 +1,49 @@
+package poh
+
+import (
+	"context"
+	"time"
+)
+
+// Clock - source of time and timers of Connection, ConnectionPool, Reaper and CircuitBreaker
+// (nil means SystemClock; see pohtest/fakeclock for tests)
+type Clock interface {
+	Now() time.Time
+	// AfterFunc - runs f after d (SystemClock runs f in its own goroutine; test clocks may run f in goroutine that
+	// moves time, so f must not wait for that goroutine); stop cancels call and returns false when f already started
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) (stop func() bool) {
+	return time.AfterFunc(d, f).Stop
+}
+
+// SystemClock - Clock of time package
+var SystemClock Clock = systemClock{}
+
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
+
+// sleepClock - waits d by clock; returns false when ctx is done before
+func sleepClock(ctx context.Context, c Clock, d time.Duration) bool {
+	ch := make(chan struct{})
+	stop := clockOrSystem(c).AfterFunc(d, func() { close(ch) })
+
+	select {
+	case <-ch:
+		return true
+	case <-ctx.Done():
+		stop()
+		return false
+	}
+}
@@ -19,6 +19,9 @@ type ExpireDurationFunc func() time.Duration
 
 type TermimateConnectionFunc[T any] func(ctx context.Context, conn T) error
 
+// ConnectionCloseHookFunc - runs before connection termination (log, clean up)
+type ConnectionCloseHookFunc[T any] func(ctx context.Context, conn T)
+
 func freeConnectionFuncEmpty() {}
 
 type Connection[T any] struct {
@@ -31,11 +34,43 @@ type Connection[T any] struct {
 	ID           string
 	UsedQty      int
 
+	// LockTime - time of last lock for use (borrow)
+	LockTime time.Time
+	// BusyTime - total time connection was in use
+	BusyTime time.Duration
+	// KeepaliveTime - time of last keepalive of idle connection (keepalive does not change LastUseTime)
+	KeepaliveTime time.Time
+	// LastError - last error of termination or check connection
+	LastError error
+	// BorrowStack - stack of last borrower (set by pool in debug mode)
+	BorrowStack string
+	// Reclaimed - connection was terminated by pool while it was in use too long
+	Reclaimed bool
+	// Broken - connection should not be used anymore (it will be closed when free)
+	Broken bool
+
+	// OnClose - runs once before connection termination
+	OnClose     ConnectionCloseHookFunc[T]
+	onCloseDone bool
+
+	// Clock - source of time (nil - SystemClock; set it by SetClock)
+	Clock Clock
+
+	// ctxCancel - cancels context connection was generated with (set by pool)
+	ctxCancel context.CancelCauseFunc
+
 	OpenExpire          ExpireDurationFunc
 	TermimateConnection TermimateConnectionFunc[T]
 
 	IdleExpire ExpireDurationFunc
 
+	// MaxUses - connection can not be locked after MaxUses uses (0 - unlimited)
+	MaxUses int
+	// OpenJitter - shortens OpenExpire of this connection (spreads expiration of connections)
+	OpenJitter time.Duration
+	// IdleJitter - shortens IdleExpire of this connection (spreads expiration of connections)
+	IdleJitter time.Duration
+
 	mx sync.Mutex
 }
 
@@ -55,6 +90,24 @@ func MakeConnection[T any](conn T,
 	}
 }
 
+// SetClock - sets Clock and restarts StartTime and LastUseTime by it with lock
+func (c *Connection[T]) SetClock(clock Clock) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.SetClockInternal(clock)
+}
+
+// SetClockInternal - sets Clock and restarts StartTime and LastUseTime by it without lock (use SetClock)
+func (c *Connection[T]) SetClockInternal(clock Clock) {
+	c.Clock = clock
+	c.StartTime = c.now()
+	c.LastUseTime = c.StartTime
+}
+
+func (c *Connection[T]) now() time.Time {
+	return clockOrSystem(c.Clock).Now()
+}
+
 // LockDo - do any with lock from this connection
 func (c *Connection[T]) LockDo(f func()) {
 	c.mx.Lock()
@@ -85,13 +138,19 @@ func (c *Connection[T]) CloseInternal(ctxIn context.Context) (err error) {
 		return nil
 	}
 
+	c.closeHookInternal(ctx)
+
 	err = c.TermimateConnection(ctx, c.Conn)
 
 	if err != nil {
+		c.LastError = err
 		return errors.Join(ErrConnTerminate, err)
 	}
 
 	c.IsTerminated = true
+	if c.ctxCancel != nil {
+		c.ctxCancel(nil)
+	}
 
 	return nil
 }
@@ -116,17 +175,32 @@ func (c *Connection[T]) TerminateInternal(ctxIn context.Context) (err error) {
 		return nil
 	}
 
+	c.closeHookInternal(ctx)
+
 	err = c.TermimateConnection(ctx, c.Conn)
 
 	if err != nil {
+		c.LastError = err
 		return errors.Join(ErrConnTerminate, err)
 	}
 
 	c.IsTerminated = true
+	if c.ctxCancel != nil {
+		c.ctxCancel(nil)
+	}
 
 	return nil
 }
 
+func (c *Connection[T]) closeHookInternal(ctx context.Context) {
+	if c.OnClose == nil || c.onCloseDone {
+		return
+	}
+
+	c.onCloseDone = true
+	c.OnClose(ctx, c.Conn)
+}
+
 // CheckIsTerminated - check connection in terminated state with lock
 func (c *Connection[T]) CheckIsTerminated() bool {
 	c.mx.Lock()
@@ -139,6 +213,30 @@ func (c *Connection[T]) CheckIsTerminatedInternal() bool {
 	return c.IsTerminated
 }
 
+// CheckReclaimed - check connection was reclaimed by pool with lock
+func (c *Connection[T]) CheckReclaimed() bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.Reclaimed
+}
+
+// MarkBroken - marks connection as broken with lock; cause is saved to LastError
+func (c *Connection[T]) MarkBroken(cause error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.Broken = true
+	if cause != nil {
+		c.LastError = cause
+	}
+}
+
+// CheckBroken - check connection is broken with lock
+func (c *Connection[T]) CheckBroken() bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.Broken
+}
+
 // CheckInUse - check connection in use with lock
 func (c *Connection[T]) CheckInUse() bool {
 	c.mx.Lock()
@@ -160,7 +258,7 @@ func (c *Connection[T]) CheckExpired() bool {
 
 // CheckExpiredInternal - checks expired open timeout  (use CheckExpired)
 func (c *Connection[T]) CheckExpiredInternal() bool {
-	return c.OpenExpire != nil && c.OpenExpire() > 0 && time.Now().After(c.StartTime.Add(c.OpenExpire()))
+	return c.OpenExpire != nil && c.OpenExpire() > 0 && !c.now().Before(c.StartTime.Add(applyJitter(c.OpenExpire(), c.OpenJitter)))
 }
 
 // CheckIdleExpired - checks expired idle timeout
@@ -172,7 +270,64 @@ func (c *Connection[T]) CheckIdleExpired() bool {
 
 // CheckIdleExpiredInternal - checks expired idle timeout (use CheckIdleExpired)
 func (c *Connection[T]) CheckIdleExpiredInternal() bool {
-	return c.IdleExpire != nil && c.IdleExpire() > 0 && time.Now().After(c.LastUseTime.Add(c.IdleExpire()))
+	return c.IdleExpire != nil && c.IdleExpire() > 0 && !c.now().Before(c.LastUseTime.Add(applyJitter(c.IdleExpire(), c.IdleJitter)))
+}
+
+// ExpireTime - returns nearest time of open or idle expiration with lock; ok is false when expiration is not set
+func (c *Connection[T]) ExpireTime() (at time.Time, ok bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.ExpireTimeInternal()
+}
+
+// ExpireTimeInternal - returns nearest time of open or idle expiration without lock (use ExpireTime)
+func (c *Connection[T]) ExpireTimeInternal() (at time.Time, ok bool) {
+	if c.OpenExpire != nil && c.OpenExpire() > 0 {
+		at = c.StartTime.Add(applyJitter(c.OpenExpire(), c.OpenJitter))
+		ok = true
+	}
+
+	if c.IdleExpire != nil && c.IdleExpire() > 0 {
+		atIdle := c.LastUseTime.Add(applyJitter(c.IdleExpire(), c.IdleJitter))
+		if !ok || atIdle.Before(at) {
+			at = atIdle
+		}
+		ok = true
+	}
+
+	return at, ok
+}
+
+// applyJitter - shortens expire by jitter when expire stays positive
+func applyJitter(expire time.Duration, jitter time.Duration) time.Duration {
+	if jitter <= 0 || jitter >= expire {
+		return expire
+	}
+	return expire - jitter
+}
+
+// CheckUsesExhausted - checks connection was used MaxUses times
+func (c *Connection[T]) CheckUsesExhausted() bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.CheckUsesExhaustedInternal()
+}
+
+// CheckUsesExhaustedInternal - checks connection was used MaxUses times (use CheckUsesExhausted)
+func (c *Connection[T]) CheckUsesExhaustedInternal() bool {
+	return c.MaxUses > 0 && c.UsedQty >= c.MaxUses
+}
+
+// CheckNeedClose - checks connection is broken, expired, idle expired or used MaxUses times with lock
+func (c *Connection[T]) CheckNeedClose() bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.CheckNeedCloseInternal()
+}
+
+// CheckNeedCloseInternal - checks connection should be closed without lock (use CheckNeedClose)
+func (c *Connection[T]) CheckNeedCloseInternal() bool {
+	return c.Broken || c.CheckExpiredInternal() || c.CheckIdleExpiredInternal() || c.CheckUsesExhaustedInternal()
 }
 
 // CanUse - check connection may be used with lock
@@ -184,8 +339,20 @@ func (c *Connection[T]) CanUse() bool {
 
 // CanUseInternal - check connection in use without lock (use CanUse)
 func (c *Connection[T]) CanUseInternal() bool {
-	expired := c.CheckExpiredInternal()
-	return !c.InUse && !c.IsTerminated && !expired
+	expired := c.CheckExpiredInternal() || c.CheckIdleExpiredInternal() || c.CheckUsesExhaustedInternal()
+	return !c.InUse && !c.IsTerminated && !c.Broken && !expired
+}
+
+// IdleDuration - returns time passed from last use with lock
+func (c *Connection[T]) IdleDuration() time.Duration {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.IdleDurationInternal()
+}
+
+// IdleDurationInternal - returns time passed from last use without lock (use IdleDuration)
+func (c *Connection[T]) IdleDurationInternal() time.Duration {
+	return c.now().Sub(c.LastUseTime)
 }
 
 // TryLock - try locks for use with lock
@@ -223,19 +390,75 @@ func (c *Connection[T]) TryLockInternal(ctxIn context.Context) (locked bool, fre
 
 	c.InUse = true
 	c.UsedQty++
-	c.LastUseTime = time.Now()
+	c.LastUseTime = c.now()
+	c.LockTime = c.LastUseTime
 
 	fn := func() {
 		ctx := mfctx.FromCtx(ctxIn).Start("poh.Connection.TryLockInternal.free")
 		ctx.With(ConnectionIDLogParam, c.ID)
 		defer func() { ctx.Complete(nil) }()
 		c.InUse = false
-		c.LastUseTime = time.Now()
+		c.LastUseTime = c.now()
+		c.BusyTime += c.LastUseTime.Sub(c.LockTime)
 	}
 
 	return true, fn
 }
 
+// ConnectionStats - snapshot of connection counters
+type ConnectionStats struct {
+	ID           string        `json:"id"`
+	InUse        bool          `json:"in_use"`
+	IsTerminated bool          `json:"is_terminated"`
+	StartTime    time.Time     `json:"start_time"`
+	LastUseTime  time.Time     `json:"last_use_time"`
+	LockTime     time.Time     `json:"lock_time"`
+	UsedQty      int           `json:"used_qty"`
+	BusyTime     time.Duration `json:"busy_time"`
+	LastError    string        `json:"last_error,omitempty"`
+	Reclaimed    bool          `json:"reclaimed,omitempty"`
+	Broken       bool          `json:"broken,omitempty"`
+	// ExpireTime - nearest time of open or idle expiration (nil when expiration is not set)
+	ExpireTime *time.Time `json:"expire_time,omitempty"`
+}
+
+// Stats - returns snapshot of connection counters with lock
+func (c *Connection[T]) Stats() ConnectionStats {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.StatsInternal()
+}
+
+// StatsInternal - returns snapshot of connection counters without lock (use Stats)
+func (c *Connection[T]) StatsInternal() ConnectionStats {
+	res := ConnectionStats{
+		ID:           c.ID,
+		InUse:        c.InUse,
+		IsTerminated: c.IsTerminated,
+		StartTime:    c.StartTime,
+		LastUseTime:  c.LastUseTime,
+		LockTime:     c.LockTime,
+		UsedQty:      c.UsedQty,
+		BusyTime:     c.BusyTime,
+		Reclaimed:    c.Reclaimed,
+		Broken:       c.Broken,
+	}
+
+	if c.InUse {
+		res.BusyTime += c.now().Sub(c.LockTime)
+	}
+
+	if c.LastError != nil {
+		res.LastError = c.LastError.Error()
+	}
+
+	if at, ok := c.ExpireTimeInternal(); ok {
+		res.ExpireTime = &at
+	}
+
+	return res
+}
+
 // CheckAndClose - close connection when Cfg is set; doClose - close was tryed; with lock
 func (c *Connection[T]) CheckAndClose(ctxIn context.Context) (doClose bool, err error) {
 	c.mx.Lock()
@@ -253,7 +476,7 @@ func (c *Connection[T]) CheckAndCloseInternal(ctxIn context.Context) (doClose bo
 	if c.InUse {
 		return false, nil
 	}
-	if !c.CheckExpiredInternal() && !c.CheckIdleExpiredInternal() {
+	if !c.CheckNeedCloseInternal() {
 		return false, nil
 	}
 
@@ -262,11 +485,11 @@ func (c *Connection[T]) CheckAndCloseInternal(ctxIn context.Context) (doClose bo
 	return true, err
 }
 
-// CloseJobRun runs close process
+// CloseJobRun runs close process (goroutine per connection; ConnectionPool uses Reaper instead)
 func (c *Connection[T]) CloseJobRun(ctxBase context.Context, checkTimeout time.Duration) {
 	go func() {
 		for !c.CheckIsTerminated() {
-			time.Sleep(checkTimeout)
+			sleepClock(context.Background(), c.Clock, checkTimeout)
 			c.CheckAndClose(ctxBase)
 		}
 	}()
@@ -1,8 +1,10 @@
 package poh
 
 import (
+	"container/list"
 	"context"
 	"errors"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -11,18 +13,30 @@ import (
 
 const DefaultConnectionPoolCheckTimeout = time.Second
 
+// ConnectionGeneratorFunc - generates connection; ctxBase is done when pool is closed, caller gives up
+// while connection is generating or generated connection is terminated
 type ConnectionGeneratorFunc[T any] func(ctxBase context.Context) (*Connection[T], error)
 
 type CountFunc func() int
 
+// ValidateConnectionFunc - checks connection is alive before it lends (ping)
+type ValidateConnectionFunc[T any] func(ctx context.Context, conn T) error
+
+// ConnectionHookFunc - runs on connection lifecycle event; error means connection should be terminated
+type ConnectionHookFunc[T any] func(ctx context.Context, conn T) error
+
 type ConnectionPool[T any] struct {
 	ConnectionGenerator ConnectionGeneratorFunc[T]
 
 	MaxCount CountFunc
 	MinCount CountFunc
+	// MaxCreating - limit of connections generating at the same time (nil or 0 - unlimited)
+	MaxCreating CountFunc
 
 	conns map[string]*Connection[T]
 	free  map[string]struct{}
+	// pending - count of reserved slots with connection generating now (counts toward MaxCount)
+	pending int
 
 	mx sync.Mutex
 
@@ -31,7 +45,92 @@ type ConnectionPool[T any] struct {
 
 	CheckTimeout time.Duration
 
+	// ValidateConnection - when set runs on borrow of idle connection (without pool lock); failed connection terminates
+	ValidateConnection ValidateConnectionFunc[T]
+	// ValidateIdleTimeout - validate only connections idle longer than it (0 - always validate)
+	ValidateIdleTimeout time.Duration
+
+	// Keepalive - when set ClearAndOpenJobStep runs it on connections idle longer than KeepaliveIdle;
+	// failed connection terminates
+	Keepalive ValidateConnectionFunc[T]
+	// KeepaliveIdle - idle time of connection before keepalive
+	KeepaliveIdle time.Duration
+	// KeepaliveTimeout - timeout of one keepalive call (0 - without timeout)
+	KeepaliveTimeout time.Duration
+
+	// MaxUses - sets Connection.MaxUses of generated connections when it is not set
+	MaxUses int
+	// ExpireJitter - max random value of Connection.OpenJitter and Connection.IdleJitter of generated connections
+	ExpireJitter time.Duration
+
+	// Breaker - when set stops connection generation after consecutive failures (Get returns ErrBreakerOpen)
+	Breaker *CircuitBreaker
+
+	// RateLimit - when set limits rate of connection generation (Get returns ErrRateLimitCP, GetWait waits)
+	RateLimit *RateLimiter
+	// stopWake - stops timer that serves waiters when RateLimit token is available
+	stopWake func() bool
+
+	// LeakThreshold - connections held longer are reported to OnLeak (0 - disabled)
+	LeakThreshold time.Duration
+	// OnLeak - receives connections held longer than LeakThreshold or reclaimed
+	OnLeak LeakReportFunc
+	// MaxHoldTime - connections held longer are terminated and removed from pool (0 - disabled)
+	MaxHoldTime time.Duration
+	// DebugStacks - saves stack of borrower to Connection.BorrowStack
+	DebugStacks bool
+
+	// OnCreate - runs after connection is generated (session setup); fail terminates connection
+	OnCreate ConnectionHookFunc[T]
+	// OnBorrow - runs before connection is lent (without pool lock); fail terminates connection
+	OnBorrow ConnectionHookFunc[T]
+	// OnReturn - runs when connection is released (reset session state); fail terminates connection
+	OnReturn ConnectionHookFunc[T]
+	// OnClose - sets Connection.OnClose of generated connections when it is not set
+	OnClose ConnectionCloseHookFunc[T]
+
+	// IsBroken - classifies error of connection use passed to Acquire release or Do; broken connection is terminated
+	IsBroken IsBrokenConnectionFunc
+
+	// ReservedCount - count of connections (of MaxCount) only callers with ReservedPriority or higher may take
+	ReservedCount CountFunc
+	// ReservedPriority - min caller priority (see WithPriority) allowed to use reserved connections (0 - PriorityHigh)
+	ReservedPriority int
+
+	// Autoscaler - when set ClearAndOpenJobStep opens connections up to its target (as MinCount)
+	// and closes idle connections over target
+	Autoscaler *Autoscaler
+
+	// Clock - source of time of pool and generated connections without Clock (nil - SystemClock; set it by SetClock)
+	Clock Clock
+
+	// Reaper - closes connections when they expire; may be shared by pools (nil - only ClearAndOpenJobRun clears)
+	Reaper *Reaper
+
+	waiters *list.List
+	// chFree - closed on release of connection (see LockChan)
 	chFree chan struct{}
+
+	leakReported map[string]time.Time
+	// affinity - id of connection last borrowed by session key
+	affinity map[string]string
+	// affinitySession - session key of connection in affinity (connection is remembered by one session only)
+	affinitySession map[string]string
+
+	counters connectionPoolCounters
+	metrics  *connectionPoolMetrics
+
+	// serving - ServeWaitersInternal is running
+	serving bool
+	// closing - connections taken from pool under lock that are closed by unlock without pool lock
+	closing []*closingConn[T]
+	// onDrop - called when generated connection is removed from pool or is not added to pool (used by MultiPool);
+	// it may be called with pool lock
+	onDrop func(c *Connection[T])
+
+	closed       bool
+	drained      chan struct{}
+	shutdownErrs []error
 }
 
 func MakeConnectionPool[T any](ctxBase context.Context,
@@ -54,177 +153,965 @@ func MakeConnectionPool[T any](ctxBase context.Context,
 
 		CheckTimeout: DefaultConnectionPoolCheckTimeout,
 
-		chFree: make(chan struct{}),
+		waiters: list.New(),
+		chFree:  make(chan struct{}),
+
+		leakReported: make(map[string]time.Time),
+		affinity:     make(map[string]string),
+
+		affinitySession: make(map[string]string),
+
+		Reaper: MakeReaper(ctxBase),
+	}
+}
+
+// SetClock - sets Clock of pool and its Reaper
+func (cp *ConnectionPool[T]) SetClock(clock Clock) {
+	cp.mx.Lock()
+	cp.Clock = clock
+	reaper := cp.Reaper
+	cp.unlock()
+
+	if reaper != nil {
+		reaper.SetClock(clock)
 	}
 }
 
+func (cp *ConnectionPool[T]) now() time.Time {
+	return clockOrSystem(cp.Clock).Now()
+}
+
 // LockDo - do any with lock from this connection pool
 func (cp *ConnectionPool[T]) LockDo(f func()) {
 	cp.mx.Lock()
-	defer cp.mx.Unlock()
+	defer cp.unlock()
 	f()
 }
 
+// Get - gets idle connection or generates new one (without waiting when pool is overflowed);
+// returns ErrOverflowCP while waiters with the same or higher priority are in queue (connections are kept for them)
 func (cp *ConnectionPool[T]) Get(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
-	cp.mx.Lock()
-	defer cp.mx.Unlock()
+	start := cp.now()
+	defer func() { cp.acquireDone(ctxIn, start, err) }()
 
-	c, f, e := cp.GetInternal(ctxIn)
+	priority := PriorityFromCtx(ctxIn)
 
-	return c, func() {
+	for {
 		cp.mx.Lock()
-		defer cp.mx.Unlock()
-		f()
-	}, e
+		var g connGrant[T]
+		if cp.hasWaitersBeforeInternal(priority) {
+			err = ErrOverflowCP
+		} else {
+			g, err = cp.getInternal(ctxIn, true)
+		}
+		cp.unlock()
+
+		if err != nil {
+			return nil, freeConnectionFuncEmpty, err
+		}
+		if g.reserved {
+			return cp.createReserved(ctxIn)
+		}
+		if cp.checkOrDrop(ctxIn, g) {
+			return g.conn, cp.lockedFree(g.conn, g.free), nil
+		}
+	}
 }
 
-func (cp *ConnectionPool[T]) LockChan() chan struct{} {
+// GetInternal - gets idle connection or generates new one; without lock (free is without lock too)
+//
+// Deprecated: connection is generated and validated with pool lock held; use Get or GetWait
+func (cp *ConnectionPool[T]) GetInternal(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
+	for {
+		var g connGrant[T]
+		g, err = cp.getInternal(ctxIn, true)
+		if err != nil {
+			return nil, freeConnectionFuncEmpty, err
+		}
+		if g.reserved {
+			return cp.createReservedInternal(ctxIn)
+		}
+
+		errC := cp.checkBorrowed(ctxIn, g)
+		if errC == nil {
+			return g.conn, g.free, nil
+		}
+		cp.dropBorrowedInternal(ctxIn, g, errC)
+	}
+}
+
+// getInternal - gets idle connection or reserves slot for new connection; MaxCreating is not checked
+// when checkCreating is false; idle connection should be checked by checkBorrowed without lock; without lock
+func (cp *ConnectionPool[T]) getInternal(ctxIn context.Context, checkCreating bool) (g connGrant[T], err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.GetInternal")
+	defer func() { ctx.Complete(err) }()
+
+	if cp.closed {
+		return g, ErrClosedCP
+	}
+
+	err = cp.CheckReservedInternal(PriorityFromCtx(ctxIn))
+	if err != nil {
+		return g, err
+	}
+
+	session, hasSession := SessionFromCtx(ctxIn)
+	if hasSession {
+		id, ok := cp.affinity[session]
+		if _, free := cp.free[id]; ok && free {
+			g, ok = cp.borrowIdleInternal(ctx, id)
+			if ok {
+				cp.counters.affinityHits++
+				return g, nil
+			}
+		}
+	}
+
+	for k := range cp.free {
+		g, ok := cp.borrowIdleInternal(ctx, k)
+		if !ok {
+			continue
+		}
+
+		if hasSession {
+			cp.rememberSessionInternal(session, g.conn.ID)
+		}
+
+		return g, nil
+	}
+
+	err = cp.reserveInternal(checkCreating)
+	if err != nil {
+		return g, err
+	}
+
+	return connGrant[T]{reserved: true}, nil
+}
+
+// borrowIdleInternal - locks idle connection and takes it from idle; connection idle long enough for validation
+// or with OnBorrow set is marked for checkBorrowed (without pool lock); without lock
+func (cp *ConnectionPool[T]) borrowIdleInternal(ctx context.Context, k string) (g connGrant[T], ok bool) {
+	c := cp.conns[k]
+	idle := c.IdleDuration()
+	l, freeF := c.TryLock(ctx)
+	if !l {
+		freeF()
+		cp.clearInternal(k)
+		return g, false
+	}
+
+	delete(cp.free, k)
+
+	cp.borrowedInternal(c)
+
+	validate := cp.validateDue(idle)
+
+	return connGrant[T]{
+		conn: c,
+		free: func() {
+			cp.ReleaseInternal(c, freeF)
+		},
+		unlock:   freeF,
+		check:    validate || cp.OnBorrow != nil,
+		validate: validate,
+	}, true
+}
+
+// checkBorrowed - validates borrowed idle connection and runs OnBorrow when grant should be checked; without pool lock
+func (cp *ConnectionPool[T]) checkBorrowed(ctx context.Context, g connGrant[T]) (err error) {
+	if !g.check {
+		return nil
+	}
+
+	if g.validate {
+		err = cp.validate(ctx, g.conn)
+	}
+	if err == nil {
+		err = cp.runHook(ctx, cp.OnBorrow, g.conn)
+	}
+
+	return err
+}
+
+// checkOrDrop - checkBorrowed; failed connection is removed from pool with pool lock
+func (cp *ConnectionPool[T]) checkOrDrop(ctx context.Context, g connGrant[T]) bool {
+	err := cp.checkBorrowed(ctx, g)
+	if err == nil {
+		return true
+	}
+
 	cp.mx.Lock()
-	defer cp.mx.Unlock()
+	defer cp.unlock()
 
-	return cp.chFree
+	cp.dropBorrowedInternal(ctx, g, err)
+
+	return false
 }
 
-func (cp *ConnectionPool[T]) GetWait(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
-	conn, free, err = cp.Get(ctxIn)
+// dropBorrowedInternal - removes borrowed connection that failed check and serves waiters; without lock
+func (cp *ConnectionPool[T]) dropBorrowedInternal(ctx context.Context, g connGrant[T], err error) {
+	g.unlock()
+	g.conn.LockDo(func() { g.conn.LastError = err })
+	cp.counters.validationFailed++
+	cp.removeInternal(ctx, g.conn.ID)
+	cp.checkDrainedInternal()
+	cp.ServeWaitersInternal()
+}
 
-	for err != nil && errors.Is(err, ErrConnectionCreationErrorCP) {
-		select {
-		case <-ctxIn.Done():
-			return conn, free, err
-		case <-cp.LockChan():
-			// retry
+// reserveInternal - reserves slot for new connection when MaxCount (and MaxCreating when checkCreating) allows;
+// reserved slot should be finished by createReserved or giveBackInternal; without lock
+func (cp *ConnectionPool[T]) reserveInternal(checkCreating bool) error {
+	if cp.closed {
+		return ErrClosedCP
+	}
+	if cp.MaxCount != nil && cp.MaxCount() > 0 && cp.MaxCount() <= len(cp.conns)+cp.pending {
+		return ErrOverflowCP
+	}
+	if checkCreating && cp.MaxCreating != nil && cp.MaxCreating() > 0 && cp.MaxCreating() <= cp.pending {
+		return ErrCreatingLimitCP
+	}
+	if cp.RateLimit != nil && !cp.RateLimit.Allow() {
+		cp.counters.rateLimited++
+		cp.wakeWaitersInternal(cp.RateLimit.Delay())
+		return ErrRateLimitCP
+	}
+	if cp.Breaker != nil {
+		err := cp.Breaker.Allow()
+		if err != nil {
+			if cp.RateLimit != nil {
+				cp.RateLimit.Cancel()
+			}
+			return err
 		}
-		conn, free, err = cp.Get(ctxIn)
 	}
 
-	return conn, free, err
+	cp.pending++
+
+	return nil
 }
 
-func (cp *ConnectionPool[T]) GetInternal(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
-	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.GetInternal")
+// wakeWaitersInternal - serves waiters after d (when rate limit token is available); without lock
+func (cp *ConnectionPool[T]) wakeWaitersInternal(d time.Duration) {
+	if cp.stopWake != nil || cp.closed {
+		return
+	}
+
+	cp.stopWake = clockOrSystem(cp.Clock).AfterFunc(d, func() {
+		cp.mx.Lock()
+		defer cp.unlock()
+
+		cp.stopWake = nil
+		cp.ServeWaitersInternal()
+	})
+}
+
+func (cp *ConnectionPool[T]) acquireDone(ctx context.Context, start time.Time, err error) {
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	if err == nil {
+		cp.metrics.recordAcquire(ctx, cp.now().Sub(start))
+	}
+	if errors.Is(err, ErrOverflowCP) {
+		cp.counters.overflows++
+		cp.metrics.addOverflow(ctx)
+	}
+}
+
+// validateDue - connection idle for idle should be validated before use
+func (cp *ConnectionPool[T]) validateDue(idle time.Duration) bool {
+	return cp.ValidateConnection != nil && (cp.ValidateIdleTimeout <= 0 || idle >= cp.ValidateIdleTimeout)
+}
+
+// validate - runs ValidateConnection for locked connection; without pool lock
+func (cp *ConnectionPool[T]) validate(ctxIn context.Context, c *Connection[T]) (err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.validate")
+	ctx.With(ConnectionIDLogParam, c.ID)
 	defer func() { ctx.Complete(err) }()
 
-	for k := range cp.free {
-		l, freeF := cp.conns[k].TryLock(ctxIn)
-		if !l {
-			freeF()
-			go cp.CheckAndClear(k)
+	err = cp.ValidateConnection(ctx, c.Conn)
+	if err != nil {
+		return errors.Join(ErrConnectionValidationCP, err)
+	}
+
+	return nil
+}
+
+// RemoveInternal - terminates connection and removes it from pool even termination fails; without lock
+// (termination runs with pool lock held; pool uses it on shutdown only)
+func (cp *ConnectionPool[T]) RemoveInternal(ctxIn context.Context, id string) (err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.RemoveInternal")
+	ctx.With(ConnectionIDLogParam, id)
+	defer func() { ctx.Complete(err) }()
+
+	c, ok := cp.detachInternal(ctx, id)
+	if !ok {
+		return nil
+	}
+
+	err = c.Terminate(ctx)
+	if err != nil {
+		cp.counters.terminateErrors++
+	}
+
+	return err
+}
+
+// closingConn - connection taken from pool under lock and closed by unlock without pool lock
+type closingConn[T any] struct {
+	ctx context.Context
+	c   *Connection[T]
+	// removed - connection is removed from pool and terminated even in use (see removeInternal);
+	// otherwise idle connection stays in pool until it is closed (see clearInternal)
+	removed bool
+	err     error
+}
+
+// removeInternal - removes connection from pool; it is terminated by unlock without pool lock
+// even termination fails; without lock
+func (cp *ConnectionPool[T]) removeInternal(ctx context.Context, id string) {
+	c, ok := cp.detachInternal(ctx, id)
+	if !ok {
+		return
+	}
+
+	cp.closing = append(cp.closing, &closingConn[T]{ctx: ctx, c: c, removed: true})
+}
+
+// detachInternal - removes connection from pool without termination; without lock
+func (cp *ConnectionPool[T]) detachInternal(ctx context.Context, id string) (c *Connection[T], ok bool) {
+	c, ok = cp.conns[id]
+	if !ok {
+		return nil, false
+	}
+
+	delete(cp.free, id)
+	delete(cp.conns, id)
+	cp.metrics.addTermination(ctx)
+	cp.unscheduleExpireInternal(id)
+	cp.forgetConnectionInternal(id)
+	cp.dropped(c)
+
+	return c, true
+}
+
+// dropped - runs onDrop for connection that is not in pool anymore
+func (cp *ConnectionPool[T]) dropped(c *Connection[T]) {
+	if cp.onDrop != nil {
+		cp.onDrop(c)
+	}
+}
+
+// unlock - closes connections taken from pool under lock without pool lock and unlocks pool
+// (so hung termination does not block pool)
+func (cp *ConnectionPool[T]) unlock() {
+	for len(cp.closing) > 0 {
+		closing := cp.closing
+		cp.closing = nil
+		cp.mx.Unlock()
+
+		for _, item := range closing {
+			if item.removed {
+				item.err = item.c.Terminate(item.ctx)
+			} else {
+				_, item.err = item.c.CheckAndClose(item.ctx)
+			}
+		}
+
+		cp.mx.Lock()
+		cp.closedInternal(closing)
+	}
+
+	cp.mx.Unlock()
+}
+
+// closedInternal - counts termination errors of closed connections and removes closed idle connections from pool;
+// idle connection that failed to close is idle again and its close is retried by ClearJobStepInternal; without lock
+func (cp *ConnectionPool[T]) closedInternal(closing []*closingConn[T]) {
+	removed := false
+	for _, item := range closing {
+		if item.err != nil {
+			cp.counters.terminateErrors++
+		}
+
+		id := item.c.ID
+		if _, ok := cp.conns[id]; item.removed || !ok {
 			continue
 		}
 
-		delete(cp.free, k)
-		return cp.conns[k], func() {
-			freeF()
+		if item.c.CheckIsTerminated() {
+			cp.counters.expired++
+			cp.detachInternal(item.ctx, id)
+			removed = true
+			continue
+		}
 
-			cp.ResetFreeCnahInternal()
+		if cp.closed {
+			err := cp.RemoveInternal(item.ctx, id)
+			if err != nil {
+				cp.shutdownErrs = append(cp.shutdownErrs, err)
+			}
+			removed = true
+			continue
+		}
+
+		cp.free[id] = struct{}{}
+	}
+
+	if removed {
+		cp.checkDrainedInternal()
+		cp.ServeWaitersInternal()
+	}
+}
+
+// ReleaseInternal - returns locked connection to pool and hands it to the first waiter; without lock
+func (cp *ConnectionPool[T]) ReleaseInternal(c *Connection[T], freeF FreeConnectionFunc) {
+	freeF()
+	cp.ResetFreeCnahInternal()
+
+	c.LockDo(func() {
+		hold := c.LastUseTime.Sub(c.LockTime)
+		cp.counters.holdCount++
+		cp.counters.holdDuration += hold
+		cp.metrics.recordHold(cp.ctxBase, hold)
+	})
+
+	if _, ok := cp.conns[c.ID]; !ok {
+		return
+	}
 
-			cp.free[k] = struct{}{}
-		}, nil
+	if c.CheckBroken() || c.CheckUsesExhausted() {
+		if c.CheckBroken() {
+			cp.counters.broken++
+		} else {
+			cp.counters.expired++
+		}
+		cp.removeInternal(cp.ctxBase, c.ID)
+		cp.checkDrainedInternal()
+		cp.ServeWaitersInternal()
+		return
+	}
+
+	if cp.closed {
+		err := cp.RemoveInternal(cp.ctxBase, c.ID)
+		if err != nil {
+			cp.shutdownErrs = append(cp.shutdownErrs, err)
+		}
+		cp.checkDrainedInternal()
+		return
 	}
 
-	return cp.GenerateConnectionInternal(ctxIn)
+	cp.free[c.ID] = struct{}{}
+	cp.scheduleExpireInternal(c)
+
+	cp.ServeWaitersInternal()
 }
 
+// GenerateConnection - reserves slot and generates new connection locked for use (ignores idle connections)
+func (cp *ConnectionPool[T]) GenerateConnection(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
+	cp.mx.Lock()
+	err = cp.reserveInternal(true)
+	cp.unlock()
+
+	if err != nil {
+		return nil, freeConnectionFuncEmpty, err
+	}
+
+	return cp.createReserved(ctxIn)
+}
+
+// GenerateConnectionInternal - reserves slot and generates new connection locked for use; without lock (free is without lock too)
+//
+// Deprecated: connection is generated with pool lock held; use GenerateConnection
+func (cp *ConnectionPool[T]) GenerateConnectionInternal(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
+	err = cp.reserveInternal(true)
+	if err != nil {
+		return nil, freeConnectionFuncEmpty, err
+	}
+
+	return cp.createReservedInternal(ctxIn)
+}
+
+// LockChan - returns channel that is closed on next release of connection
+//
+// Deprecated: GetWait waits in queue; use it
+func (cp *ConnectionPool[T]) LockChan() chan struct{} {
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	return cp.chFree
+}
+
+// ResetFreeCnahInternal - closes channel of LockChan and makes new one; without lock
+//
+// Deprecated: ReleaseInternal calls it
 func (cp *ConnectionPool[T]) ResetFreeCnahInternal() {
 	close(cp.chFree)
 	cp.chFree = make(chan struct{})
 }
 
-func (cp *ConnectionPool[T]) GenerateConnectionInternal(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
-	if cp.MaxCount != nil && cp.MaxCount() > 0 && cp.MaxCount() <= len(cp.conns) {
-		return nil, freeConnectionFuncEmpty, ErrOverflowCP
+// createReserved - generates connection for reserved slot without pool lock and registers it in pool
+// free is with pool lock
+func (cp *ConnectionPool[T]) createReserved(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.createReserved")
+	defer func() { ctx.Complete(err) }()
+
+	connN, canceled, err := cp.dialReserved(ctx, ctxIn)
+
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	conn, free, err = cp.registerReservedInternal(ctx, ctxIn, connN, canceled, err)
+	if err != nil {
+		return nil, freeConnectionFuncEmpty, err
 	}
 
-	connN, err := cp.ConnectionGenerator(cp.ctxBase)
+	return conn, cp.lockedFree(conn, free), nil
+}
+
+// createReservedInternal - createReserved with pool lock held; free is without lock
+func (cp *ConnectionPool[T]) createReservedInternal(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.createReservedInternal")
+	defer func() { ctx.Complete(err) }()
+
+	connN, canceled, err := cp.dialReserved(ctx, ctxIn)
+
+	return cp.registerReservedInternal(ctx, ctxIn, connN, canceled, err)
+}
+
+// dialReserved - generates connection for reserved slot and runs OnCreate and OnBorrow;
+// canceled is true when generation failed because caller gave up
+func (cp *ConnectionPool[T]) dialReserved(ctx context.Context, ctxIn context.Context) (connN *Connection[T], canceled bool, err error) {
+	connN, err = cp.generate(ctxIn)
 	if err != nil {
-		return nil, freeConnectionFuncEmpty, errors.Join(ErrConnectionCreationErrorCP, err)
+		return nil, ctxIn.Err() != nil, err
 	}
-	connN.CloseJobRun(cp.ctxBase, cp.CheckTimeout)
 
-	cp.conns[connN.ID] = connN
-	l, freeF := connN.TryLock(ctxIn)
-	if !l {
-		freeF()
+	cp.SetupConnectionInternal(connN)
+
+	err = cp.runHook(ctx, cp.OnCreate, connN)
+	if err == nil {
+		err = cp.runHook(ctx, cp.OnBorrow, connN)
+	}
+	if err != nil {
+		cp.dropped(connN)
+		return nil, false, errors.Join(err, connN.Terminate(ctx))
+	}
+
+	return connN, false, nil
+}
+
+// registerReservedInternal - frees reserved slot and registers generated connection locked for use; without lock
+// free is without lock
+func (cp *ConnectionPool[T]) registerReservedInternal(ctx context.Context, ctxIn context.Context,
+	connN *Connection[T], canceled bool, errGen error,
+) (conn *Connection[T], free FreeConnectionFunc, err error) {
+	cp.pending--
+	// slot of generating connection is free for waiters limited by MaxCreating (or MaxCount when creation failed)
+	defer cp.ServeWaitersInternal()
 
-		cp.ResetFreeCnahInternal()
+	if cp.Breaker != nil {
+		if canceled {
+			cp.Breaker.Cancel()
+		} else if errGen != nil {
+			cp.Breaker.Failure()
+		} else {
+			cp.Breaker.Success()
+		}
+	}
+
+	if errGen != nil {
+		cp.counters.createErrors++
+		cp.metrics.addCreateError(ctx)
+		return nil, freeConnectionFuncEmpty, errors.Join(ErrConnectionCreationErrorCP, errGen)
+	}
+	cp.counters.created++
+	cp.metrics.addCreate(ctx)
+
+	if cp.closed {
+		// pool was shut down while connection was generating
+		cp.dropped(connN)
+		return nil, freeConnectionFuncEmpty, errors.Join(ErrClosedCP, connN.Terminate(ctx))
+	}
 
+	cp.conns[connN.ID] = connN
+	cp.scheduleExpireInternal(connN)
+	l, freeF := connN.TryLock(ctx)
+	if !l {
 		cp.free[connN.ID] = struct{}{}
 
 		return nil, freeConnectionFuncEmpty, ErrInternalLockCP
 	}
-	return connN, func() {
-		freeF()
 
-		cp.ResetFreeCnahInternal()
+	cp.borrowedInternal(connN)
 
-		cp.free[connN.ID] = struct{}{}
+	if session, ok := SessionFromCtx(ctxIn); ok {
+		cp.rememberSessionInternal(session, connN.ID)
+	}
+
+	return connN, func() {
+		cp.ReleaseInternal(connN, freeF)
 	}, nil
 }
 
+// generate - runs ConnectionGenerator with context of pool that is canceled when caller gives up while generating;
+// context lives until generated connection is terminated; connection generated after caller gave up is terminated
+func (cp *ConnectionPool[T]) generate(ctxIn context.Context) (conn *Connection[T], err error) {
+	ctxGen, cancel := context.WithCancelCause(cp.ctxBase)
+	stop := context.AfterFunc(ctxIn, func() { cancel(context.Cause(ctxIn)) })
+
+	conn, err = cp.ConnectionGenerator(ctxGen)
+	stop()
+
+	if err != nil {
+		cancel(err)
+		return nil, err
+	}
+
+	conn.LockDo(func() { conn.ctxCancel = cancel })
+
+	if ctxIn.Err() != nil {
+		// caller gave up so connection is not needed
+		cp.dropped(conn)
+		return nil, errors.Join(context.Cause(ctxIn), conn.Terminate(context.WithoutCancel(ctxIn)))
+	}
+
+	return conn, nil
+}
+
+// runHook - runs hook for connection when hook is set
+func (cp *ConnectionPool[T]) runHook(ctxIn context.Context, hook ConnectionHookFunc[T], c *Connection[T]) (err error) {
+	if hook == nil {
+		return nil
+	}
+
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.runHook")
+	ctx.With(ConnectionIDLogParam, c.ID)
+	defer func() { ctx.Complete(err) }()
+
+	err = hook(ctx, c.Conn)
+	if err != nil {
+		return errors.Join(ErrConnectionHookCP, err)
+	}
+
+	return nil
+}
+
+// SetupConnectionInternal - applies MaxUses, ExpireJitter and OnClose to generated connection; without lock
+func (cp *ConnectionPool[T]) SetupConnectionInternal(c *Connection[T]) {
+	c.LockDo(func() {
+		if c.MaxUses == 0 {
+			c.MaxUses = cp.MaxUses
+		}
+		if c.OnClose == nil {
+			c.OnClose = cp.OnClose
+		}
+		if c.Clock == nil && cp.Clock != nil {
+			c.SetClockInternal(cp.Clock)
+		}
+		if cp.ExpireJitter > 0 {
+			c.OpenJitter = time.Duration(rand.Int63n(int64(cp.ExpireJitter)))
+			c.IdleJitter = time.Duration(rand.Int63n(int64(cp.ExpireJitter)))
+		}
+	})
+}
+
 func (cp *ConnectionPool[T]) CheckAndClear(id string) {
 	cp.mx.Lock()
-	defer cp.mx.Unlock()
+	defer cp.unlock()
 
 	cp.CheckAndClearInternal(id)
 }
 
 func (cp *ConnectionPool[T]) CheckAndClearInternal(id string) {
+	if cp.clearInternal(id) {
+		cp.ServeWaitersInternal()
+	}
+}
+
+// clearInternal - removes terminated connection from pool and takes idle connection that should be closed
+// from idle (it is closed by unlock without pool lock and stays in pool until it is closed);
+// reschedules check of idle not expired connection; without lock
+func (cp *ConnectionPool[T]) clearInternal(id string) (removed bool) {
 	c, ok := cp.conns[id]
+	if !ok {
+		return false
+	}
+
+	if c.CheckIsTerminated() {
+		cp.counters.expired++
+		cp.detachInternal(cp.ctxBase, id)
+		return true
+	}
+
+	if c.CheckInUse() {
+		return false
+	}
+
+	if !c.CheckNeedClose() {
+		cp.scheduleExpireInternal(c)
+		return false
+	}
+
+	delete(cp.free, id)
+	cp.unscheduleExpireInternal(id)
+	cp.closing = append(cp.closing, &closingConn[T]{ctx: cp.ctxBase, c: c})
+
+	return false
+}
+
+// scheduleExpireInternal - schedules CheckAndClear of connection at its expiration time in Reaper; without lock
+func (cp *ConnectionPool[T]) scheduleExpireInternal(c *Connection[T]) {
+	if cp.Reaper == nil {
+		return
+	}
+
+	at, ok := c.ExpireTime()
 	if !ok {
 		return
 	}
 
-	c.CheckAndClose(cp.ctxBase)
+	id := c.ID
+	cp.Reaper.Schedule(cp.ctxBase, id, at, func() { cp.CheckAndClear(id) })
+}
 
-	if !c.CheckIsTerminated() {
+func (cp *ConnectionPool[T]) unscheduleExpireInternal(id string) {
+	if cp.Reaper == nil {
 		return
 	}
 
-	delete(cp.free, id)
-	delete(cp.conns, id)
+	cp.Reaper.Cancel(id)
+}
+
+// Evict - terminates idle connections matching pred and marks used ones broken with cause
+// (they are terminated on release); returns count of matched connections
+func (cp *ConnectionPool[T]) Evict(pred func(c *Connection[T]) bool, cause error) (matched int) {
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	ctx := mfctx.FromCtx(cp.ctxBase).Start("poh.ConnectionPool.Evict")
+	defer func() { ctx.With("matched", matched).Complete(nil) }()
+
+	for id, c := range cp.conns {
+		if !pred(c) {
+			continue
+		}
+		matched++
+
+		if _, ok := cp.free[id]; ok {
+			c.LockDo(func() { c.LastError = cause })
+			cp.removeInternal(ctx, id)
+			continue
+		}
+
+		c.MarkBroken(cause)
+	}
+
+	cp.checkDrainedInternal()
+	cp.ServeWaitersInternal()
+
+	return matched
 }
 
 func (cp *ConnectionPool[T]) ClearAndOpenJobRun() {
 	go func() {
-		for cp.ctxBase.Err() == nil {
-			time.Sleep(cp.CheckTimeout)
+		for cp.ctxBase.Err() == nil && !cp.IsClosed() {
+			sleepClock(cp.ctxBase, cp.Clock, cp.CheckTimeout)
 			cp.ClearAndOpenJobStep()
 		}
 	}()
 }
 
 func (cp *ConnectionPool[T]) ClearAndOpenJobStep() {
-	cp.mx.Lock()
-	defer cp.mx.Unlock()
+	cp.LockDo(cp.ClearJobStepInternal)
+
+	cp.CheckLeaks()
+
+	cp.LockDo(cp.AutoscaleInternal)
+
+	cp.KeepaliveJobStep()
+
+	cp.OpenIdle()
+}
+
+// AutoscaleInternal - observes pool stats by Autoscaler and closes idle connections over its target; without lock
+func (cp *ConnectionPool[T]) AutoscaleInternal() {
+	if cp.Autoscaler == nil || cp.closed {
+		return
+	}
+
+	ctx := mfctx.FromCtx(cp.ctxBase).Start("poh.ConnectionPool.AutoscaleInternal")
+	defer func() { ctx.Complete(nil) }()
 
-	cp.ClearAndOpenJobStepInternal()
+	target := max(cp.Autoscaler.Observe(cp.StatsInternal()), cp.minCountInternal())
+
+	for id := range cp.free {
+		if len(cp.conns)+cp.pending <= target {
+			break
+		}
+		cp.removeInternal(ctx, id)
+	}
 }
-func (cp *ConnectionPool[T]) ClearAndOpenJobStepInternal() {
+
+// minCountInternal - MinCount or Autoscaler target when it is greater; without lock
+func (cp *ConnectionPool[T]) minCountInternal() int {
+	res := 0
+	if cp.MinCount != nil {
+		res = cp.MinCount()
+	}
+	if cp.Autoscaler != nil {
+		res = max(res, cp.Autoscaler.Target())
+	}
+	return res
+}
+
+// ClearJobStepInternal - clears terminated connections, closes idle connections that should be closed
+// (expired, idle expired, broken or used MaxUses times; Reaper may be nil) and retries serve waiters; without lock
+func (cp *ConnectionPool[T]) ClearJobStepInternal() {
+	if cp.closed {
+		return
+	}
+
 	for k, v := range cp.conns {
-		if v.CheckExpired() || v.CheckIsTerminated() {
-			go cp.CheckAndClear(k)
+		if _, idle := cp.free[k]; idle || v.CheckIsTerminated() {
+			cp.clearInternal(k)
 		}
 	}
 
-	cp.OpenIdleInternal()
+	cp.ServeWaitersInternal()
 }
 
+// OpenIdle - opens idle connections up to MinCount (or Autoscaler target); connections are generated without pool lock
+func (cp *ConnectionPool[T]) OpenIdle() {
+	cp.mx.Lock()
+	n := cp.reserveIdleInternal()
+	cp.unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, free, err := cp.createReserved(cp.ctxBase)
+			if err == nil {
+				free()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// OpenIdleInternal - opens idle connections up to MinCount (or Autoscaler target); without lock
+//
+// Deprecated: connections are generated with pool lock held; use OpenIdle
 func (cp *ConnectionPool[T]) OpenIdleInternal() {
-	if cp.MinCount == nil {
+	for i := cp.reserveIdleInternal(); i > 0; i-- {
+		_, free, err := cp.createReservedInternal(cp.ctxBase)
+		if err == nil {
+			free()
+		}
+	}
+}
+
+// reserveIdleInternal - reserves slots for connections up to MinCount and returns count of reserved slots; without lock
+// connections for reserved slots should be created by createReserved without lock
+func (cp *ConnectionPool[T]) reserveIdleInternal() (reserved int) {
+	minCount := cp.minCountInternal()
+
+	for i := len(cp.conns) + cp.pending; i < minCount; i++ {
+		if cp.reserveInternal(true) != nil {
+			break
+		}
+		reserved++
+	}
+
+	return reserved
+}
+
+// Shutdown - stops lending connections, rejects waiters with ErrClosedCP,
+// waits for connections in use are released until ctx is done and terminates all connections
+// returns joined termination errors (and ctx cause when connections in use were terminated by deadline)
+func (cp *ConnectionPool[T]) Shutdown(ctxIn context.Context) (err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.Shutdown")
+	defer func() { ctx.Complete(err) }()
+
+	cp.mx.Lock()
+
+	if !cp.closed {
+		cp.closed = true
+		cp.drained = make(chan struct{})
+		cp.RejectWaitersInternal(ErrClosedCP)
+		if cp.stopWake != nil {
+			cp.stopWake()
+			cp.stopWake = nil
+		}
+	}
+
+	for id := range cp.free {
+		errR := cp.RemoveInternal(ctx, id)
+		if errR != nil {
+			cp.shutdownErrs = append(cp.shutdownErrs, errR)
+		}
+	}
+	cp.checkDrainedInternal()
+
+	drained := cp.drained
+
+	cp.unlock()
+
+	var errCtx error
+	select {
+	case <-drained:
+	case <-ctxIn.Done():
+		errCtx = context.Cause(ctxIn)
+	}
+
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	for id := range cp.conns {
+		errR := cp.RemoveInternal(ctx, id)
+		if errR != nil {
+			cp.shutdownErrs = append(cp.shutdownErrs, errR)
+		}
+	}
+	cp.checkDrainedInternal()
+
+	if cp.ctxClose != nil {
+		cp.ctxClose(ErrClosedCP)
+	}
+
+	errs := cp.shutdownErrs
+	cp.shutdownErrs = nil
+
+	return errors.Join(append(errs, errCtx)...)
+}
+
+// IsClosed - pool is shut down
+func (cp *ConnectionPool[T]) IsClosed() bool {
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	return cp.closed
+}
+
+func (cp *ConnectionPool[T]) checkDrainedInternal() {
+	if cp.drained == nil || len(cp.conns) > 0 {
 		return
 	}
 
-	for i := len(cp.conns); i < cp.MinCount(); i++ {
-		_, free, _ := cp.GenerateConnectionInternal(cp.ctxBase)
-		go free()
+	select {
+	case <-cp.drained:
+	default:
+		close(cp.drained)
 	}
 }
 
 // Close - calls ctxClose if its set (error should be set)
 func (cp *ConnectionPool[T]) Close(err error) {
 	cp.mx.Lock()
-	defer cp.mx.Unlock()
+	defer cp.unlock()
 
 	if cp.ctxClose != nil {
 		cp.ctxClose(err)
@@ -0,0 +1,61 @@
+package poh
+
+import (
+	"context"
+)
+
+type sessionCtxKey struct{}
+
+// WithSession - sets session key of Get and GetWait callers; pool prefers idle connection last borrowed with the same key
+func WithSession(ctx context.Context, session string) context.Context {
+	return context.WithValue(ctx, sessionCtxKey{}, session)
+}
+
+// SessionFromCtx - returns session key set by WithSession
+func SessionFromCtx(ctx context.Context) (session string, ok bool) {
+	session, ok = ctx.Value(sessionCtxKey{}).(string)
+	return session, ok
+}
+
+// GetAffinity - Get that prefers connection last borrowed with session key when it is idle (falls back to any connection)
+func (cp *ConnectionPool[T]) GetAffinity(ctx context.Context, session string) (conn *Connection[T], free FreeConnectionFunc, err error) {
+	return cp.Get(WithSession(ctx, session))
+}
+
+// GetWaitAffinity - GetWait that prefers connection last borrowed with session key when it is idle (falls back to any connection)
+func (cp *ConnectionPool[T]) GetWaitAffinity(ctx context.Context, session string) (conn *Connection[T], free FreeConnectionFunc, err error) {
+	return cp.GetWait(WithSession(ctx, session))
+}
+
+// ForgetSession - removes remembered connection of session key
+func (cp *ConnectionPool[T]) ForgetSession(session string) {
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	if id, ok := cp.affinity[session]; ok {
+		delete(cp.affinitySession, id)
+		delete(cp.affinity, session)
+	}
+}
+
+// rememberSessionInternal - remembers connection borrowed by session; connection is remembered only for the last
+// session that borrowed it, so count of remembered sessions is not more than count of connections; without lock
+func (cp *ConnectionPool[T]) rememberSessionInternal(session string, id string) {
+	if old, ok := cp.affinitySession[id]; ok && old != session {
+		delete(cp.affinity, old)
+	}
+	if old, ok := cp.affinity[session]; ok && old != id {
+		delete(cp.affinitySession, old)
+	}
+
+	cp.affinity[session] = id
+	cp.affinitySession[id] = session
+}
+
+// forgetConnectionInternal - forgets session of removed connection; without lock
+func (cp *ConnectionPool[T]) forgetConnectionInternal(id string) {
+	if session, ok := cp.affinitySession[id]; ok {
+		delete(cp.affinity, session)
+		delete(cp.affinitySession, id)
+	}
+}
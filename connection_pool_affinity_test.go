@@ -0,0 +1,96 @@
+package poh
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestConnectionPoolGetAffinity(t *testing.T) {
+	cp := makeTestWaitPool(5)
+
+	connA, freeA, err := cp.GetAffinity(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connB, freeB, err := cp.GetAffinity(context.Background(), "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, freeC, _ := cp.Get(context.Background())
+	freeA()
+	freeB()
+	freeC()
+
+	for i := 0; i < 10; i++ {
+		conn, free, err := cp.GetAffinity(context.Background(), "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn != connB {
+			t.Fatalf("connection of session b expected but `%v`", conn.Conn)
+		}
+		free()
+	}
+
+	// remembered connection is busy so session gets other connection
+	conn, free, _ := cp.GetAffinity(context.Background(), "a")
+	connA2, freeA2, err := cp.GetWaitAffinity(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn != connA || connA2 == connA {
+		t.Errorf("fall back to other connection expected")
+	}
+	free()
+	freeA2()
+
+	if s := cp.Stats(); s.AffinityHits != 11 {
+		t.Errorf("affinity hits should be 11 but `%v`", s.AffinityHits)
+	}
+
+	cp.ForgetSession("b")
+	cp.LockDo(func() {
+		if _, ok := cp.affinity["b"]; ok {
+			t.Errorf("session should be forgotten")
+		}
+	})
+
+	cp.LockDo(func() { cp.RemoveInternal(context.Background(), connA2.ID) })
+	cp.LockDo(func() {
+		if _, ok := cp.affinity["a"]; ok {
+			t.Errorf("session of removed connection should be forgotten")
+		}
+	})
+}
+
+func TestConnectionPoolAffinityBounded(t *testing.T) {
+	cp := makeTestWaitPool(2)
+
+	conn, free, _ := cp.GetAffinity(context.Background(), "a")
+	free()
+
+	// connection handed to other session is forgotten by previous one
+	conn2, free, _ := cp.GetAffinity(context.Background(), "b")
+	free()
+	if conn2 != conn {
+		t.Fatalf("idle connection should be reused")
+	}
+
+	for i := 0; i < 100; i++ {
+		_, free, err := cp.GetAffinity(context.Background(), fmt.Sprint("s", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		free()
+	}
+
+	cp.LockDo(func() {
+		if _, ok := cp.affinity["a"]; ok {
+			t.Errorf("session a should be forgotten")
+		}
+		if len(cp.affinity) > len(cp.conns) || len(cp.affinitySession) != len(cp.affinity) {
+			t.Errorf("sessions should be bounded by connections: %v %v %v", len(cp.affinity), len(cp.affinitySession), len(cp.conns))
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package poh
+
+import (
+	"context"
+	"errors"
+
+	"github.com/myfantasy/mfctx"
+)
+
+// IsBrokenConnectionFunc - decides error of connection use means connection must be terminated instead of reuse
+type IsBrokenConnectionFunc func(err error) bool
+
+// ReleaseWithErrorFunc - returns connection to pool with error of its use (nil when ok);
+// broken connection is terminated; returns ErrReclaimedCP when connection was reclaimed by pool
+type ReleaseWithErrorFunc func(cause error) error
+
+// IsBrokenErr - error means connection is broken (ErrBrokenConnection or IsBroken says so)
+func (cp *ConnectionPool[T]) IsBrokenErr(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return errors.Is(err, ErrBrokenConnection) || cp.IsBroken != nil && cp.IsBroken(err)
+}
+
+// Acquire - GetWait that returns release function accepting error of connection use
+func (cp *ConnectionPool[T]) Acquire(ctxIn context.Context) (conn *Connection[T], release ReleaseWithErrorFunc, err error) {
+	conn, free, err := cp.GetWait(ctxIn)
+	if err != nil {
+		return conn, func(cause error) error { return nil }, err
+	}
+
+	return conn, func(cause error) error {
+		if cp.IsBrokenErr(cause) {
+			conn.MarkBroken(cause)
+		}
+
+		free()
+
+		if conn.CheckReclaimed() {
+			return ErrReclaimedCP
+		}
+
+		return nil
+	}, nil
+}
+
+// Do - runs f with connection got by GetWait and releases connection with error of f;
+// connection is terminated when error is broken (see IsBrokenErr) or f panics
+func (cp *ConnectionPool[T]) Do(ctxIn context.Context, f func(ctx context.Context, conn T) error) (err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.Do")
+	defer func() { ctx.Complete(err) }()
+
+	conn, release, err := cp.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx.With(ConnectionIDLogParam, conn.ID)
+
+	defer func() {
+		if r := recover(); r != nil {
+			release(ErrBrokenConnection)
+			panic(r)
+		}
+	}()
+
+	err = f(ctx, conn.Conn)
+
+	return errors.Join(err, release(err))
+}
@@ -0,0 +1,96 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var errTestBadConn = fmt.Errorf("test bad conn")
+
+func TestConnectionPoolDo(t *testing.T) {
+	cp := makeTestWaitPool(1)
+	cp.IsBroken = func(err error) bool { return errors.Is(err, errTestBadConn) }
+
+	var first int
+	err := cp.Do(context.Background(), func(ctx context.Context, conn int) error {
+		first = conn
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errQuery := fmt.Errorf("test query error")
+	err = cp.Do(context.Background(), func(ctx context.Context, conn int) error {
+		if conn != first {
+			t.Errorf("connection should be reused after success")
+		}
+		return errQuery
+	})
+	if !errors.Is(err, errQuery) {
+		t.Errorf("err should be query error but `%v`", err)
+	}
+
+	err = cp.Do(context.Background(), func(ctx context.Context, conn int) error {
+		if conn != first {
+			t.Errorf("connection should be reused after not broken error")
+		}
+		return fmt.Errorf("wrap: %w", errTestBadConn)
+	})
+	if !errors.Is(err, errTestBadConn) {
+		t.Errorf("err should be bad conn error but `%v`", err)
+	}
+
+	err = cp.Do(context.Background(), func(ctx context.Context, conn int) error {
+		if conn == first {
+			t.Errorf("broken connection should not be reused")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := cp.Stats(); s.Broken != 1 || s.OpenConnections != 1 || s.Idle != 1 {
+		t.Errorf("wrong pool stats: %v", ToJson(s))
+	}
+}
+
+func TestConnectionPoolAcquireBroken(t *testing.T) {
+	cp := makeTestWaitPool(1)
+
+	conn, release, err := cp.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = release(fmt.Errorf("test: %w", ErrBrokenConnection))
+	if err != nil {
+		t.Errorf("release err should be nil but `%v`", err)
+	}
+
+	if !conn.CheckIsTerminated() || !conn.Stats().Broken {
+		t.Errorf("broken connection should be terminated: %v", ToJson(conn.Stats()))
+	}
+}
+
+func TestConnectionPoolDoPanic(t *testing.T) {
+	cp := makeTestWaitPool(1)
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("panic should be passed")
+			}
+		}()
+		cp.Do(context.Background(), func(ctx context.Context, conn int) error {
+			panic("test panic")
+		})
+	}()
+
+	if s := cp.Stats(); s.Broken != 1 || s.OpenConnections != 0 {
+		t.Errorf("connection should be terminated after panic: %v", ToJson(s))
+	}
+}
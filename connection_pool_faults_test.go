@@ -0,0 +1,131 @@
+package poh_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/poh"
+	"github.com/myfantasy/poh/pohtest"
+)
+
+func TestConnectionPoolFaults(t *testing.T) {
+	faults := pohtest.MakeFaults(42)
+	faults.FailRate = 0.3
+	faults.TerminateErrRate = 0.2
+	g := pohtest.MakeGenerator(faults)
+
+	cp := poh.MakeConnectionPool(context.Background(), nil, g.Generate,
+		func() int { return 4 },
+		nil,
+	)
+	cp.MaxUses = 3
+	// waiters are retried after failed creation by maintenance job
+	cp.CheckTimeout = time.Millisecond
+	cp.ClearAndOpenJobRun()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				err := cp.Do(ctx, func(ctx context.Context, conn *pohtest.Resource) error {
+					return conn.Use()
+				})
+				cancel()
+				if err != nil && !errors.Is(err, pohtest.ErrInjected) {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	pohtest.AssertPoolIdle(t, cp, time.Second)
+
+	faults.Set(func(f *pohtest.Faults) { f.TerminateErrRate = 0 })
+
+	err := cp.Shutdown(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+
+	if s := cp.Stats(); s.CreateErrors == 0 || s.TerminateErrors == 0 {
+		t.Errorf("faults should be injected: %v", poh.ToJson(s))
+	}
+
+	// connections with failed termination are removed from pool without retry
+	created, terminated := g.Counts()
+	if open := g.Open(); created-terminated != len(open) || len(open) != int(cp.Stats().TerminateErrors) {
+		t.Errorf("not terminated resources `%v` should be connections with terminate errors: %v",
+			open, poh.ToJson(cp.Stats()))
+	}
+}
+
+func TestConnectionPoolHangingGenerator(t *testing.T) {
+	faults := pohtest.MakeFaults(1)
+	faults.HangRate = 1
+	g := pohtest.MakeGenerator(faults)
+
+	cp := poh.MakeConnectionPool(context.Background(), nil, g.Generate, nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	_, _, err := cp.GetWait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("deadline error expected but `%v`", err)
+	}
+
+	pohtest.AssertPoolIdle(t, cp, time.Second)
+	g.AssertNoLeaks(t)
+}
+
+func TestHubFaults(t *testing.T) {
+	faults := pohtest.MakeFaults(1)
+	faults.FailRate = 1
+
+	generated := make(chan string, 2)
+	hub := poh.MakeHub[string, string](
+		context.Background(),
+		func(ctx context.Context) (keys []string, err error) {
+			return []string{"a"}, nil
+		},
+		func(ctx context.Context, key string, point string) (err error) {
+			return nil
+		},
+		pohtest.WrapPointGenerate(faults, func(ctx context.Context, key string) (point string, err error) {
+			generated <- key
+			return key, nil
+		}),
+		func(ctx context.Context, key string, point string) (err error) {
+			return nil
+		},
+	)
+
+	err := hub.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100 && hub.Len() == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if hub.Len() != 0 || len(generated) != 0 {
+		t.Errorf("point should not be generated while generation fails")
+	}
+
+	faults.Set(func(f *pohtest.Faults) { f.FailRate = 0 })
+
+	err = hub.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := <-generated; key != "a" {
+		t.Errorf("point a should be generated but `%v`", key)
+	}
+}
@@ -0,0 +1,205 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/myfantasy/mfctx"
+)
+
+// GetN - gets n connections at once or none; waits in queue as one waiter while pool can not give all of them
+// (so concurrent GetN callers do not hold part of connections each); free returns all connections to pool;
+// MaxCreating is not applied to connections generated by GetN
+func (cp *ConnectionPool[T]) GetN(ctxIn context.Context, n int) (conns []*Connection[T], free FreeConnectionFunc, err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.GetN")
+	ctx.With("n", n)
+	defer func() { ctx.Complete(err) }()
+
+	if n <= 0 {
+		return nil, freeConnectionFuncEmpty, nil
+	}
+
+	start := cp.now()
+	defer func() { cp.acquireDone(ctxIn, start, err) }()
+
+	priority := PriorityFromCtx(ctxIn)
+
+	cp.mx.Lock()
+
+	if cp.closed {
+		cp.unlock()
+		return nil, freeConnectionFuncEmpty, ErrClosedCP
+	}
+	if n > cp.limitInternal(priority) {
+		cp.unlock()
+		return nil, freeConnectionFuncEmpty, ErrTooManyCP
+	}
+
+	err = ErrOverflowCP
+	if !cp.hasWaitersBeforeInternal(priority) {
+		var items []connGrant[T]
+		items, err = cp.getNInternal(ctxIn, n)
+		if err != nil && !isWaitableErr(err) {
+			cp.unlock()
+			return nil, freeConnectionFuncEmpty, err
+		}
+
+		if err == nil {
+			cp.unlock()
+			conns, free, err = cp.createN(ctxIn, items)
+			if err == nil || !isWaitableErr(err) || ctxIn.Err() != nil {
+				return conns, free, err
+			}
+			cp.mx.Lock()
+		}
+	}
+
+	w := &connWaiter[T]{
+		ctx:      ctxIn,
+		priority: priority,
+		n:        n,
+		ch:       make(chan connGrant[T], 1),
+	}
+	cp.enqueueInternal(w, false)
+	cp.retryWaitersInternal(err)
+	cp.counters.waitCount++
+	waitStart := cp.now()
+	defer cp.LockDo(func() { cp.counters.waitDuration += cp.now().Sub(waitStart) })
+
+	cp.unlock()
+
+	for {
+		select {
+		case g := <-w.ch:
+			if g.err != nil {
+				return nil, freeConnectionFuncEmpty, g.err
+			}
+
+			conns, free, err = cp.createN(ctxIn, g.items)
+			if err == nil || !isWaitableErr(err) || ctxIn.Err() != nil {
+				return conns, free, err
+			}
+
+			// creation failed so wait again first in queue
+			cp.mx.Lock()
+			if cp.closed {
+				cp.unlock()
+				return nil, freeConnectionFuncEmpty, ErrClosedCP
+			}
+			cp.enqueueInternal(w, true)
+			cp.retryWaitersInternal(err)
+			cp.unlock()
+
+			continue
+		case <-ctxIn.Done():
+		}
+
+		break
+	}
+
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	if w.elem != nil {
+		cp.waiters.Remove(w.elem)
+		w.elem = nil
+		// waiter for many connections may block smaller waiters behind it
+		cp.ServeWaitersInternal()
+	} else {
+		cp.giveBackInternal(<-w.ch)
+		cp.ServeWaitersInternal()
+	}
+
+	return nil, freeConnectionFuncEmpty, errors.Join(err, context.Cause(ctxIn))
+}
+
+// limitInternal - count of connections caller with priority may hold (MaxCount without ReservedCount); without lock
+func (cp *ConnectionPool[T]) limitInternal(priority int) int {
+	if cp.MaxCount == nil || cp.MaxCount() <= 0 {
+		return int(^uint(0) >> 1)
+	}
+
+	limit := cp.MaxCount()
+	if cp.ReservedCount != nil && priority < cp.reservedPriorityInternal() {
+		limit -= max(cp.ReservedCount(), 0)
+	}
+
+	return limit
+}
+
+// getNInternal - gets n idle connections or reserved slots or none of them; without lock
+func (cp *ConnectionPool[T]) getNInternal(ctx context.Context, n int) (items []connGrant[T], err error) {
+	if cp.closed {
+		return nil, ErrClosedCP
+	}
+
+	busy := len(cp.conns) - len(cp.free) + cp.pending
+	if busy+n > cp.limitInternal(PriorityFromCtx(ctx)) {
+		return nil, ErrOverflowCP
+	}
+
+	for i := 0; i < n; i++ {
+		var g connGrant[T]
+		g, err = cp.getInternal(ctx, false)
+		if err != nil {
+			for _, item := range items {
+				cp.giveBackInternal(item)
+			}
+			return nil, err
+		}
+		items = append(items, g)
+	}
+
+	return items, nil
+}
+
+// createN - generates connections for reserved slots of items and checks idle connections of items;
+// on fail returns all connections to pool
+func (cp *ConnectionPool[T]) createN(ctx context.Context, items []connGrant[T]) (conns []*Connection[T], free FreeConnectionFunc, err error) {
+	conns = make([]*Connection[T], len(items))
+	frees := make([]FreeConnectionFunc, len(items))
+	errs := make([]error, len(items))
+
+	var wg sync.WaitGroup
+	for i, item := range items {
+		if !item.reserved && !item.check {
+			conns[i] = item.conn
+			frees[i] = cp.lockedFree(item.conn, item.free)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, item connGrant[T]) {
+			defer wg.Done()
+
+			if item.reserved {
+				conns[i], frees[i], errs[i] = cp.createReserved(ctx)
+				return
+			}
+
+			frees[i] = freeConnectionFuncEmpty
+			errs[i] = cp.checkBorrowed(ctx, item)
+			if errs[i] != nil {
+				cp.LockDo(func() { cp.dropBorrowedInternal(ctx, item, errs[i]) })
+				return
+			}
+			conns[i], frees[i] = item.conn, cp.lockedFree(item.conn, item.free)
+		}(i, item)
+	}
+	wg.Wait()
+
+	free = func() {
+		for _, f := range frees {
+			f()
+		}
+	}
+
+	err = errors.Join(errs...)
+	if err != nil {
+		free()
+		return nil, freeConnectionFuncEmpty, err
+	}
+
+	return conns, free, nil
+}
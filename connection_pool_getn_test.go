@@ -0,0 +1,145 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnectionPoolGetN(t *testing.T) {
+	cp := makeTestWaitPool(3)
+
+	conns, free, err := cp.GetN(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 2 || conns[0] == conns[1] {
+		t.Fatalf("2 different connections expected: %v", ToJson(conns))
+	}
+
+	_, _, err = cp.GetN(context.Background(), 4)
+	if !errors.Is(err, ErrTooManyCP) {
+		t.Fatalf("too many error expected but `%v`", err)
+	}
+
+	ctxT, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err = cp.GetN(ctxT, 2)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("deadline error expected but `%v`", err)
+	}
+	if s := cp.Stats(); s.InUse != 2 || s.OpenConnections != 2 || s.Waiters != 0 {
+		t.Errorf("no connection should be taken by failed GetN: %v", ToJson(s))
+	}
+
+	free()
+
+	if s := cp.Stats(); s.InUse != 0 || s.Idle != 2 {
+		t.Errorf("all connections should be free: %v", ToJson(s))
+	}
+}
+
+func TestConnectionPoolGetNWaitsAll(t *testing.T) {
+	cp := makeTestWaitPool(3)
+
+	_, free1, _ := cp.Get(context.Background())
+	_, free2, _ := cp.Get(context.Background())
+
+	done := make(chan []*Connection[int], 1)
+	go func() {
+		conns, free, err := cp.GetN(context.Background(), 3)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- conns
+		free()
+	}()
+	waitWaitersCount(t, cp, 1)
+
+	// one connection is not enough; waiter for many connections is first in queue
+	free1()
+	if cp.WaitersCount() != 1 {
+		t.Fatalf("GetN should wait for all connections")
+	}
+	if s := cp.Stats(); s.Idle != 1 {
+		t.Errorf("connection should stay idle: %v", ToJson(s))
+	}
+
+	free2()
+
+	conns := <-done
+	if len(conns) != 3 {
+		t.Errorf("3 connections expected but `%v`", len(conns))
+	}
+}
+
+func TestConnectionPoolGetNBeforeGet(t *testing.T) {
+	cp := makeTestWaitPool(3)
+
+	_, free1, _ := cp.Get(context.Background())
+	_, free2, _ := cp.Get(context.Background())
+	_, free3, _ := cp.Get(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		_, free, err := cp.GetN(context.Background(), 2)
+		if err == nil {
+			free()
+		}
+		done <- err
+	}()
+	waitWaitersCount(t, cp, 1)
+
+	free1()
+
+	// released connection is kept for GetN waiter
+	_, _, err := cp.Get(context.Background())
+	if !errors.Is(err, ErrOverflowCP) {
+		t.Fatalf("err should be ErrOverflowCP while GetN waits but `%v`", err)
+	}
+
+	free2()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	free3()
+
+	_, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Errorf("connection should be got when queue is empty but `%v`", err)
+	}
+	free()
+}
+
+func TestConnectionPoolGetNConcurrent(t *testing.T) {
+	cp := makeTestWaitPool(4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				conns, free, err := cp.GetN(ctx, 3)
+				cancel()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(conns) != 3 {
+					t.Errorf("3 connections expected but `%v`", len(conns))
+				}
+				free()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if s := cp.Stats(); s.InUse != 0 || s.Waiters != 0 || s.Creating != 0 {
+		t.Errorf("wrong pool state: %v", ToJson(s))
+	}
+}
@@ -0,0 +1,144 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/myfantasy/mfctx"
+)
+
+type keepaliveItem[T any] struct {
+	c     *Connection[T]
+	freeF FreeConnectionFunc
+	err   error
+
+	// use counters of connection before keepalive lock (keepalive is not counted as use)
+	used     int
+	lastUse  time.Time
+	lockTime time.Time
+	busy     time.Duration
+}
+
+// KeepaliveJobStep - runs Keepalive without pool lock on connections idle longer than KeepaliveIdle;
+// connections are locked while keepalive runs so they are not lent; failed connections are terminated
+// returns count of checked connections
+func (cp *ConnectionPool[T]) KeepaliveJobStep() (checked int) {
+	if cp.Keepalive == nil {
+		return 0
+	}
+
+	ctx := mfctx.FromCtx(cp.ctxBase).Start("poh.ConnectionPool.KeepaliveJobStep")
+	defer func() { ctx.With("checked", checked).Complete(nil) }()
+
+	cp.mx.Lock()
+	items := cp.keepaliveLockInternal(ctx)
+	cp.unlock()
+
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		go func(item *keepaliveItem[T]) {
+			defer wg.Done()
+			item.err = cp.keepaliveCall(ctx, item.c)
+		}(item)
+	}
+	wg.Wait()
+
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	for _, item := range items {
+		item.freeF()
+		// keepalive is not counted as use so connection still can idle expire
+		item.c.LockDo(func() {
+			item.c.UsedQty = item.used
+			item.c.LastUseTime = item.lastUse
+			item.c.LockTime = item.lockTime
+			item.c.BusyTime = item.busy
+			item.c.KeepaliveTime = item.c.now()
+		})
+
+		if _, ok := cp.conns[item.c.ID]; !ok {
+			continue
+		}
+
+		if item.err != nil || cp.closed {
+			if item.err != nil {
+				item.c.LockDo(func() { item.c.LastError = item.err })
+				cp.counters.keepaliveFailed++
+			}
+			cp.removeInternal(ctx, item.c.ID)
+			cp.checkDrainedInternal()
+			continue
+		}
+
+		cp.free[item.c.ID] = struct{}{}
+		cp.scheduleExpireInternal(item.c)
+	}
+
+	cp.ServeWaitersInternal()
+
+	return len(items)
+}
+
+// keepaliveLockInternal - locks connections idle (from last use or keepalive) longer than KeepaliveIdle
+// and takes them from idle; without lock
+func (cp *ConnectionPool[T]) keepaliveLockInternal(ctx context.Context) (items []*keepaliveItem[T]) {
+	if cp.closed {
+		return nil
+	}
+
+	for id := range cp.free {
+		c := cp.conns[id]
+
+		item := &keepaliveItem[T]{c: c}
+		idle := time.Duration(0)
+		c.LockDo(func() {
+			item.used, item.lastUse, item.lockTime, item.busy = c.UsedQty, c.LastUseTime, c.LockTime, c.BusyTime
+
+			since := c.LastUseTime
+			if c.KeepaliveTime.After(since) {
+				since = c.KeepaliveTime
+			}
+			idle = c.now().Sub(since)
+		})
+		if idle < cp.KeepaliveIdle {
+			continue
+		}
+
+		l, freeF := c.TryLock(ctx)
+		if !l {
+			freeF()
+			cp.clearInternal(id)
+			continue
+		}
+
+		delete(cp.free, id)
+		item.freeF = freeF
+		items = append(items, item)
+	}
+
+	return items
+}
+
+func (cp *ConnectionPool[T]) keepaliveCall(ctxIn context.Context, c *Connection[T]) (err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.keepaliveCall")
+	ctx.With(ConnectionIDLogParam, c.ID)
+	defer func() { ctx.Complete(err) }()
+
+	ctxCall := context.Context(ctx)
+	if cp.KeepaliveTimeout > 0 {
+		var cancel context.CancelFunc
+		ctxCall, cancel = context.WithTimeout(ctx, cp.KeepaliveTimeout)
+		defer cancel()
+	}
+
+	err = cp.Keepalive(ctxCall, c.Conn)
+	if err != nil {
+		return errors.Join(ErrConnectionKeepaliveCP, err)
+	}
+
+	return nil
+}
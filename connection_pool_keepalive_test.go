@@ -0,0 +1,121 @@
+package poh
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
+)
+
+func TestConnectionPoolKeepalive(t *testing.T) {
+	clock := fakeclock.New(time.Time{})
+	cp := makeTestWaitPool(5)
+	cp.SetClock(clock)
+	cp.MinCount = func() int { return 2 }
+	cp.KeepaliveIdle = time.Minute
+
+	pinged := make(map[int]int)
+	cp.Keepalive = func(ctx context.Context, conn int) error {
+		cp.LockDo(func() {
+			for id, c := range cp.conns {
+				if _, ok := cp.free[id]; ok && c.Conn == conn {
+					t.Errorf("connection should not be idle while keepalive")
+				}
+			}
+		})
+		pinged[conn]++
+		return fmt.Errorf("test dead connection")
+	}
+
+	cp.ClearAndOpenJobStep()
+	if len(pinged) != 0 {
+		t.Fatalf("fresh connections should not be pinged: %v", pinged)
+	}
+
+	conn, free, _ := cp.Get(context.Background())
+	clock.Advance(2 * time.Minute)
+
+	cp.ClearAndOpenJobStep()
+
+	if len(pinged) != 1 {
+		t.Fatalf("only idle connection should be pinged: %v", pinged)
+	}
+	free()
+
+	s := cp.Stats()
+	if s.KeepaliveFailed != 1 || s.OpenConnections != 2 || s.Idle != 2 {
+		t.Errorf("dead connection should be replaced: %v", ToJson(s))
+	}
+	if pinged[conn.Conn] != 0 {
+		t.Errorf("connection in use should not be pinged")
+	}
+
+	for _, c := range cp.ConnectionsStats() {
+		if c.ID != conn.ID && c.UsedQty != 1 {
+			t.Errorf("keepalive should not be counted as use: %v", ToJson(c))
+		}
+	}
+
+	clock.Advance(30 * time.Second)
+	cp.ClearAndOpenJobStep()
+	if len(pinged) != 1 {
+		t.Errorf("recently used connections should not be pinged: %v", pinged)
+	}
+}
+
+func TestConnectionPoolKeepaliveIdleExpire(t *testing.T) {
+	clock := fakeclock.New(time.Time{})
+	n := 0
+	cp := MakeConnectionPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context) (*Connection[int], error) {
+			n++
+			return MakeConnection(n,
+				func(ctx context.Context, conn int) error { return nil },
+				nil,
+				func() time.Duration { return 3 * time.Minute },
+			), nil
+		},
+		func() int { return 5 },
+		func() int { return 1 },
+	)
+	cp.SetClock(clock)
+	cp.KeepaliveIdle = time.Minute
+
+	pinged := 0
+	cp.Keepalive = func(ctx context.Context, conn int) error {
+		pinged++
+		return nil
+	}
+
+	cp.ClearAndOpenJobStep()
+	first := cp.ConnectionsStats()[0]
+
+	clock.Advance(2 * time.Minute)
+	cp.ClearAndOpenJobStep()
+
+	cs := cp.ConnectionsStats()[0]
+	if pinged != 1 || cs.ID != first.ID {
+		t.Fatalf("idle connection should be pinged once: %v %v", pinged, ToJson(cs))
+	}
+	if !cs.LastUseTime.Equal(first.LastUseTime) || cs.BusyTime != first.BusyTime || cs.UsedQty != first.UsedQty {
+		t.Errorf("keepalive should not change use of connection: %v", ToJson(cs))
+	}
+
+	clock.Advance(30 * time.Second)
+	cp.ClearAndOpenJobStep()
+	if pinged != 1 {
+		t.Errorf("recently pinged connection should not be pinged: %v", pinged)
+	}
+
+	clock.Advance(time.Minute)
+	cp.ClearAndOpenJobStep()
+
+	cs = cp.ConnectionsStats()[0]
+	if cs.ID == first.ID {
+		t.Errorf("connection should be idle expired in spite of keepalive: %v", ToJson(cs))
+	}
+}
@@ -0,0 +1,131 @@
+package poh
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"github.com/myfantasy/mfctx"
+)
+
+// LeakInfo - connection held longer than ConnectionPool.LeakThreshold
+type LeakInfo struct {
+	ID       string        `json:"id"`
+	LockTime time.Time     `json:"lock_time"`
+	Held     time.Duration `json:"held"`
+	// Stack - stack of borrower when ConnectionPool.DebugStacks is set
+	Stack string `json:"stack,omitempty"`
+	// Reclaimed - connection was terminated and removed from pool because of ConnectionPool.MaxHoldTime
+	Reclaimed bool `json:"reclaimed"`
+}
+
+// LeakReportFunc - receives connections held too long; it is called without pool lock
+type LeakReportFunc func(info LeakInfo)
+
+// ReleaseConnectionFunc - returns connection to pool; returns ErrReclaimedCP when connection was reclaimed by pool
+type ReleaseConnectionFunc func() error
+
+// GetWaitRelease - GetWait that returns release function reporting late release of reclaimed connection
+func (cp *ConnectionPool[T]) GetWaitRelease(ctxIn context.Context) (conn *Connection[T], release ReleaseConnectionFunc, err error) {
+	conn, free, err := cp.GetWait(ctxIn)
+	if err != nil {
+		return conn, func() error { return nil }, err
+	}
+
+	return conn, func() error {
+		free()
+
+		if conn.CheckReclaimed() {
+			return ErrReclaimedCP
+		}
+
+		return nil
+	}, nil
+}
+
+// borrowedInternal - saves borrower stack when DebugStacks is set; without lock
+func (cp *ConnectionPool[T]) borrowedInternal(c *Connection[T]) {
+	if !cp.DebugStacks {
+		return
+	}
+
+	stack := string(debug.Stack())
+	c.LockDo(func() { c.BorrowStack = stack })
+}
+
+// CheckLeaks - reports connections held longer than LeakThreshold to OnLeak once per borrow
+// and reclaims connections held longer than MaxHoldTime
+func (cp *ConnectionPool[T]) CheckLeaks() (leaks []LeakInfo) {
+	cp.mx.Lock()
+	leaks = cp.CheckLeaksInternal()
+	onLeak := cp.OnLeak
+	cp.unlock()
+
+	if onLeak != nil {
+		for _, l := range leaks {
+			onLeak(l)
+		}
+	}
+
+	return leaks
+}
+
+// CheckLeaksInternal - finds leaked connections and reclaims connections held longer than MaxHoldTime; without lock (use CheckLeaks)
+func (cp *ConnectionPool[T]) CheckLeaksInternal() (leaks []LeakInfo) {
+	if cp.LeakThreshold <= 0 && cp.MaxHoldTime <= 0 {
+		return nil
+	}
+
+	ctx := mfctx.FromCtx(cp.ctxBase).Start("poh.ConnectionPool.CheckLeaksInternal")
+	defer func() { ctx.Complete(nil) }()
+
+	reclaimed := false
+
+	for id, c := range cp.conns {
+		if _, ok := cp.free[id]; ok {
+			continue
+		}
+
+		var info LeakInfo
+		inUse := false
+		c.LockDo(func() {
+			inUse = c.InUse
+			info = LeakInfo{
+				ID:       c.ID,
+				LockTime: c.LockTime,
+				Held:     cp.now().Sub(c.LockTime),
+				Stack:    c.BorrowStack,
+			}
+		})
+
+		if !inUse {
+			continue
+		}
+
+		if cp.MaxHoldTime > 0 && info.Held > cp.MaxHoldTime {
+			info.Reclaimed = true
+			c.LockDo(func() { c.Reclaimed = true })
+			cp.counters.reclaimed++
+			cp.removeInternal(ctx, id)
+			reclaimed = true
+		} else if cp.LeakThreshold <= 0 || info.Held <= cp.LeakThreshold ||
+			cp.leakReported[id].Equal(info.LockTime) {
+			continue
+		}
+
+		cp.leakReported[id] = info.LockTime
+		leaks = append(leaks, info)
+	}
+
+	for id := range cp.leakReported {
+		if _, ok := cp.conns[id]; !ok {
+			delete(cp.leakReported, id)
+		}
+	}
+
+	if reclaimed {
+		cp.ServeWaitersInternal()
+	}
+
+	return leaks
+}
@@ -0,0 +1,100 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
+)
+
+func TestConnectionPoolLeaks(t *testing.T) {
+	cp := makeTestWaitPool(2)
+	cp.LeakThreshold = time.Millisecond
+	cp.DebugStacks = true
+	clock := fakeclock.New(time.Time{})
+	cp.SetClock(clock)
+
+	var reported []LeakInfo
+	cp.OnLeak = func(info LeakInfo) { reported = append(reported, info) }
+
+	conn, release, err := cp.GetWaitRelease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, free, _ := cp.Get(context.Background())
+	free()
+
+	clock.Advance(2 * time.Millisecond)
+
+	cp.CheckLeaks()
+	cp.CheckLeaks()
+
+	if len(reported) != 1 {
+		t.Fatalf("leak should be reported once but `%v`", ToJson(reported))
+	}
+	if reported[0].ID != conn.ID || reported[0].Reclaimed || reported[0].Held < time.Millisecond {
+		t.Errorf("wrong leak info: %v", ToJson(reported[0]))
+	}
+	if !strings.Contains(reported[0].Stack, "TestConnectionPoolLeaks") {
+		t.Errorf("leak info should contain borrower stack: %v", reported[0].Stack)
+	}
+
+	err = release()
+	if err != nil {
+		t.Errorf("release err should be nil but `%v`", err)
+	}
+}
+
+func TestConnectionPoolReclaim(t *testing.T) {
+	cp := makeTestWaitPool(1)
+	cp.MaxHoldTime = time.Millisecond
+	clock := fakeclock.New(time.Time{})
+	cp.SetClock(clock)
+
+	var reported []LeakInfo
+	cp.OnLeak = func(info LeakInfo) { reported = append(reported, info) }
+
+	conn, release, err := cp.GetWaitRelease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitConn := make(chan *Connection[int])
+	go func() {
+		c, free, err := cp.GetWait(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		free()
+		waitConn <- c
+	}()
+	waitWaitersCount(t, cp, 1)
+
+	clock.Advance(2 * time.Millisecond)
+
+	cp.CheckLeaks()
+
+	if len(reported) != 1 || !reported[0].Reclaimed {
+		t.Fatalf("reclaim should be reported but `%v`", ToJson(reported))
+	}
+	if !conn.CheckIsTerminated() {
+		t.Errorf("reclaimed connection should be terminated")
+	}
+
+	if c := <-waitConn; c.ID == conn.ID {
+		t.Errorf("waiter should get new connection after reclaim")
+	}
+
+	err = release()
+	if !errors.Is(err, ErrReclaimedCP) {
+		t.Errorf("late release err should be ErrReclaimedCP but `%v`", err)
+	}
+
+	if s := cp.Stats(); s.Reclaimed != 1 || s.OpenConnections != 1 || s.Idle != 1 {
+		t.Errorf("wrong pool stats: %v", ToJson(s))
+	}
+}
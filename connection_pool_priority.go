@@ -0,0 +1,92 @@
+package poh
+
+import (
+	"context"
+)
+
+const (
+	// PriorityLow - priority of background callers (batch jobs)
+	PriorityLow = -1
+	// PriorityNormal - default priority of callers
+	PriorityNormal = 0
+	// PriorityHigh - default ConnectionPool.ReservedPriority
+	PriorityHigh = 1
+)
+
+type priorityCtxKey struct{}
+
+// WithPriority - sets priority of Get and GetWait callers; waiters with higher priority are served first
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityCtxKey{}, priority)
+}
+
+// PriorityFromCtx - returns priority set by WithPriority (PriorityNormal when it is not set)
+func PriorityFromCtx(ctx context.Context) int {
+	p, ok := ctx.Value(priorityCtxKey{}).(int)
+	if !ok {
+		return PriorityNormal
+	}
+	return p
+}
+
+// reservedPriorityInternal - min priority allowed to use reserved connections; without lock
+func (cp *ConnectionPool[T]) reservedPriorityInternal() int {
+	if cp.ReservedPriority == 0 {
+		return PriorityHigh
+	}
+	return cp.ReservedPriority
+}
+
+// CheckReservedInternal - returns ErrOverflowCP when caller with priority can not take connection because
+// only ReservedCount connections are left for high priority callers; without lock
+func (cp *ConnectionPool[T]) CheckReservedInternal(priority int) error {
+	if cp.ReservedCount == nil || priority >= cp.reservedPriorityInternal() {
+		return nil
+	}
+	if cp.MaxCount == nil || cp.MaxCount() <= 0 {
+		return nil
+	}
+
+	reserved := cp.ReservedCount()
+	if reserved <= 0 {
+		return nil
+	}
+
+	busy := len(cp.conns) - len(cp.free) + cp.pending
+	if busy >= cp.MaxCount()-reserved {
+		return ErrOverflowCP
+	}
+
+	return nil
+}
+
+// enqueueInternal - puts waiter in queue after waiters with the same or higher priority
+// (before waiters with the same priority when first is set); without lock
+func (cp *ConnectionPool[T]) enqueueInternal(w *connWaiter[T], first bool) {
+	if first {
+		for e := cp.waiters.Front(); e != nil; e = e.Next() {
+			if e.Value.(*connWaiter[T]).priority <= w.priority {
+				w.elem = cp.waiters.InsertBefore(w, e)
+				return
+			}
+		}
+		w.elem = cp.waiters.PushBack(w)
+		return
+	}
+
+	for e := cp.waiters.Back(); e != nil; e = e.Prev() {
+		if e.Value.(*connWaiter[T]).priority >= w.priority {
+			w.elem = cp.waiters.InsertAfter(w, e)
+			return
+		}
+	}
+	w.elem = cp.waiters.PushFront(w)
+}
+
+// hasWaitersBeforeInternal - queue has waiters that should be served before caller with priority; without lock
+func (cp *ConnectionPool[T]) hasWaitersBeforeInternal(priority int) bool {
+	if cp.waiters.Len() == 0 {
+		return false
+	}
+	return cp.waiters.Front().Value.(*connWaiter[T]).priority >= priority
+}
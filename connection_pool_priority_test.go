@@ -0,0 +1,121 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestConnectionPoolReservedCount(t *testing.T) {
+	cp := makeTestWaitPool(3)
+	cp.ReservedCount = func() int { return 1 }
+
+	ctxLow := WithPriority(context.Background(), PriorityLow)
+	ctxHigh := WithPriority(context.Background(), PriorityHigh)
+
+	_, free1, err := cp.Get(ctxLow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, free2, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = cp.Get(ctxLow)
+	if !errors.Is(err, ErrOverflowCP) {
+		t.Fatalf("low priority caller should not take reserved connection but `%v`", err)
+	}
+
+	_, free3, err := cp.Get(ctxHigh)
+	if err != nil {
+		t.Fatalf("high priority caller should take reserved connection but `%v`", err)
+	}
+
+	free1()
+
+	// idle connection is reserved too while 2 connections are busy
+	free3()
+	_, _, err = cp.Get(ctxLow)
+	if err != nil {
+		t.Fatalf("low priority caller should take connection when 1 is busy but `%v`", err)
+	}
+
+	_, _, err = cp.Get(context.Background())
+	if !errors.Is(err, ErrOverflowCP) {
+		t.Fatalf("normal priority caller should not take reserved idle connection but `%v`", err)
+	}
+
+	free2()
+}
+
+func TestConnectionPoolGetWaitPriority(t *testing.T) {
+	cp := makeTestWaitPool(1)
+
+	_, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan int, 3)
+	start := func(priority int, cnt int) {
+		go func() {
+			_, f, err := cp.GetWait(WithPriority(context.Background(), priority))
+			if err != nil {
+				t.Error(err)
+				order <- 0
+				return
+			}
+			order <- priority
+			f()
+		}()
+		waitWaitersCount(t, cp, cnt)
+	}
+
+	start(PriorityLow, 1)
+	start(PriorityNormal, 2)
+	start(PriorityHigh, 3)
+
+	free()
+
+	for _, expected := range []int{PriorityHigh, PriorityNormal, PriorityLow} {
+		if p := <-order; p != expected {
+			t.Errorf("waiter with priority %v expected but `%v`", expected, p)
+		}
+	}
+}
+
+func TestConnectionPoolGetWaitReservedBeforeQueue(t *testing.T) {
+	cp := makeTestWaitPool(2)
+	cp.ReservedCount = func() int { return 1 }
+
+	_, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, f, err := cp.GetWait(WithPriority(context.Background(), PriorityLow))
+		if err == nil {
+			f()
+		}
+		done <- err
+	}()
+	waitWaitersCount(t, cp, 1)
+
+	_, freeH, err := cp.GetWait(WithPriority(context.Background(), PriorityHigh))
+	if err != nil {
+		t.Fatalf("high priority caller should pass queued low priority waiter but `%v`", err)
+	}
+	if cp.WaitersCount() != 1 {
+		t.Errorf("low priority waiter should still wait")
+	}
+
+	freeH()
+	free()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
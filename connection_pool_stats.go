@@ -0,0 +1,125 @@
+package poh
+
+import (
+	"time"
+)
+
+// ConnectionPoolStats - snapshot of connection pool state and counters
+type ConnectionPoolStats struct {
+	// MaxOpenConnections - MaxCount value (0 - unlimited)
+	MaxOpenConnections int `json:"max_open"`
+
+	OpenConnections int `json:"open"`
+	InUse           int `json:"in_use"`
+	Idle            int `json:"idle"`
+	Waiters         int `json:"waiters"`
+	// Creating - count of connections generating now
+	Creating int `json:"creating"`
+	// Breaker - state of Breaker when it is set
+	Breaker *CircuitBreakerStats `json:"breaker,omitempty"`
+
+	// WaitCount - count of GetWait calls waited in queue
+	WaitCount int64 `json:"wait_count"`
+	// WaitDuration - total time GetWait callers waited in queue
+	WaitDuration time.Duration `json:"wait_duration"`
+	// HoldCount - count of connections released to pool
+	HoldCount int64 `json:"hold_count"`
+	// HoldDuration - total time of released connections was in use
+	HoldDuration time.Duration `json:"hold_duration"`
+
+	Created          int64 `json:"created"`
+	CreateErrors     int64 `json:"create_errors"`
+	Overflows        int64 `json:"overflows"`
+	Expired          int64 `json:"expired"`
+	ValidationFailed int64 `json:"validation_failed"`
+	TerminateErrors  int64 `json:"terminate_errors"`
+	// Reclaimed - count of connections terminated because of MaxHoldTime
+	Reclaimed int64 `json:"reclaimed"`
+	// Broken - count of connections terminated on release as broken
+	Broken int64 `json:"broken"`
+	// AffinityHits - count of borrows of connection remembered for session key
+	AffinityHits int64 `json:"affinity_hits"`
+	// RateLimited - count of connection generations delayed by RateLimit
+	RateLimited int64 `json:"rate_limited"`
+	// KeepaliveFailed - count of connections terminated because of failed keepalive
+	KeepaliveFailed int64 `json:"keepalive_failed"`
+}
+
+// connectionPoolCounters - counters changed under pool lock
+type connectionPoolCounters struct {
+	waitCount    int64
+	waitDuration time.Duration
+	holdCount    int64
+	holdDuration time.Duration
+
+	created          int64
+	createErrors     int64
+	overflows        int64
+	expired          int64
+	validationFailed int64
+	terminateErrors  int64
+	reclaimed        int64
+	broken           int64
+	affinityHits     int64
+	rateLimited      int64
+	keepaliveFailed  int64
+}
+
+// Stats - returns snapshot of pool state and counters
+func (cp *ConnectionPool[T]) Stats() ConnectionPoolStats {
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	return cp.StatsInternal()
+}
+
+// StatsInternal - returns snapshot of pool state and counters without lock (use Stats)
+func (cp *ConnectionPool[T]) StatsInternal() ConnectionPoolStats {
+	res := ConnectionPoolStats{
+		OpenConnections: len(cp.conns),
+		Idle:            len(cp.free),
+		InUse:           len(cp.conns) - len(cp.free),
+		Waiters:         cp.waiters.Len(),
+		Creating:        cp.pending,
+
+		WaitCount:    cp.counters.waitCount,
+		WaitDuration: cp.counters.waitDuration,
+		HoldCount:    cp.counters.holdCount,
+		HoldDuration: cp.counters.holdDuration,
+
+		Created:          cp.counters.created,
+		CreateErrors:     cp.counters.createErrors,
+		Overflows:        cp.counters.overflows,
+		Expired:          cp.counters.expired,
+		ValidationFailed: cp.counters.validationFailed,
+		TerminateErrors:  cp.counters.terminateErrors,
+		Reclaimed:        cp.counters.reclaimed,
+		Broken:           cp.counters.broken,
+		AffinityHits:     cp.counters.affinityHits,
+		RateLimited:      cp.counters.rateLimited,
+		KeepaliveFailed:  cp.counters.keepaliveFailed,
+	}
+
+	if cp.MaxCount != nil && cp.MaxCount() > 0 {
+		res.MaxOpenConnections = cp.MaxCount()
+	}
+
+	if cp.Breaker != nil {
+		res.Breaker = ToP(cp.Breaker.Stats())
+	}
+
+	return res
+}
+
+// ConnectionsStats - returns snapshots of all pool connections
+func (cp *ConnectionPool[T]) ConnectionsStats() []ConnectionStats {
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	res := make([]ConnectionStats, 0, len(cp.conns))
+	for _, c := range cp.conns {
+		res = append(res, c.Stats())
+	}
+
+	return res
+}
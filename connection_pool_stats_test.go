@@ -0,0 +1,92 @@
+package poh
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
+)
+
+func TestConnectionPoolStats(t *testing.T) {
+	cp := makeTestWaitPool(2)
+	clock := fakeclock.New(time.Time{})
+	cp.SetClock(clock)
+
+	_, free1, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, free2, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = cp.Get(context.Background())
+	if err == nil {
+		t.Fatal("overflow error expected")
+	}
+
+	clock.Advance(time.Millisecond)
+	free1()
+
+	s := cp.Stats()
+	if s.MaxOpenConnections != 2 || s.OpenConnections != 2 || s.InUse != 1 || s.Idle != 1 {
+		t.Errorf("wrong pool state: %v", ToJson(s))
+	}
+	if s.Created != 2 || s.Overflows != 1 || s.HoldCount != 1 || s.HoldDuration != time.Millisecond {
+		t.Errorf("wrong pool counters: %v", ToJson(s))
+	}
+
+	_, free, err := cp.GetWait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan FreeConnectionFunc)
+	go func() {
+		_, free3, err := cp.GetWait(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		done <- free3
+	}()
+	waitWaitersCount(t, cp, 1)
+
+	clock.Advance(2 * time.Millisecond)
+	free2()
+	free3 := <-done
+	free()
+	free3()
+
+	s = cp.Stats()
+	if s.WaitCount != 1 || s.WaitDuration != 2*time.Millisecond || s.InUse != 0 || s.Idle != 2 {
+		t.Errorf("wrong wait counters: %v", ToJson(s))
+	}
+}
+
+func TestConnectionPoolStatsValidation(t *testing.T) {
+	cp := makeTestWaitPool(2)
+
+	c, free, _ := cp.Get(context.Background())
+	free()
+
+	c.TermimateConnection = func(ctx context.Context, conn int) error { return fmt.Errorf("test terminate error") }
+	cp.ValidateConnection = func(ctx context.Context, conn int) error { return fmt.Errorf("test ping error") }
+
+	_, _, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := cp.Stats()
+	if s.ValidationFailed != 1 || s.TerminateErrors != 1 || s.Created != 2 {
+		t.Errorf("wrong validation counters: %v", ToJson(s))
+	}
+
+	cs := c.Stats()
+	if cs.LastError != "test terminate error" || cs.UsedQty != 2 {
+		t.Errorf("wrong connection stats: %v", ToJson(cs))
+	}
+}
@@ -2,8 +2,13 @@ package poh
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
 )
 
 func TestConnectionPoolMinCount(t *testing.T) {
@@ -55,14 +60,748 @@ func TestConnectionPoolClear(t *testing.T) {
 
 	cp.ClearAndOpenJobStep()
 
-	// wait for background process
-	time.Sleep(time.Millisecond)
-
 	if len(cp.conns) != 0 {
 		t.Errorf("conns should be 0 after clear but `%v`", len(cp.conns))
 	}
 }
 
+func TestConnectionPoolClearIdleWithoutReaper(t *testing.T) {
+	terminated := 0
+	cp := MakeConnectionPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context) (*Connection[struct{}], error) {
+			return MakeConnection(struct{}{},
+				func(ctx context.Context, conn struct{}) error { terminated++; return nil },
+				nil,
+				func() time.Duration { return time.Second },
+			), nil
+		},
+		nil,
+		nil,
+	)
+	clock := fakeclock.New(time.Time{})
+	cp.SetClock(clock)
+	cp.Reaper = nil
+
+	_, free, _ := cp.Get(context.Background())
+	free()
+
+	clock.Advance(time.Hour)
+	cp.ClearAndOpenJobStep()
+
+	if terminated != 1 || len(cp.conns) != 0 {
+		t.Errorf("idle expired connection should be closed but terminated `%v` conns `%v`", terminated, len(cp.conns))
+	}
+}
+
 func TestConnectionPoolGet(t *testing.T) {
 
 }
+
+func TestConnectionPoolInternalCompat(t *testing.T) {
+	cp := makeTestWaitPool(3)
+	cp.MinCount = func() int { return 2 }
+
+	cp.LockDo(cp.OpenIdleInternal)
+
+	var conn *Connection[int]
+	var free FreeConnectionFunc
+	var err error
+	cp.LockDo(func() {
+		if len(cp.conns) != 2 || len(cp.free) != 2 || cp.pending != 0 {
+			t.Errorf("idle connections should be opened without reserved slots: %v %v %v", len(cp.conns), len(cp.free), cp.pending)
+		}
+
+		conn, free, err = cp.GetInternal(context.Background())
+	})
+	if err != nil || conn == nil {
+		t.Fatalf("connection expected but `%v`", err)
+	}
+
+	released := cp.LockChan()
+	cp.LockDo(free)
+
+	select {
+	case <-released:
+	default:
+		t.Errorf("lock chan should be closed on release")
+	}
+
+	if s := cp.Stats(); s.OpenConnections != 2 || s.Idle != 2 {
+		t.Errorf("connection should be returned to pool: %v", ToJson(s))
+	}
+}
+
+func TestConnectionPoolValidate(t *testing.T) {
+	cp := MakeConnectionPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context) (*Connection[int], error) {
+			return MakeConnection(0,
+				func(ctx context.Context, conn int) error { return nil },
+				nil,
+				nil,
+			), nil
+		},
+		nil,
+		nil,
+	)
+
+	conn, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	badID := conn.ID
+	free()
+
+	validated := 0
+	cp.ValidateConnection = func(ctx context.Context, conn int) error {
+		validated++
+		return fmt.Errorf("test ping error")
+	}
+
+	conn, free, err = cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer free()
+
+	if validated != 1 {
+		t.Errorf("validated should be 1 but `%v`", validated)
+	}
+
+	if conn.ID == badID {
+		t.Errorf("connection `%v` should be replaced after failed validation", badID)
+	}
+
+	if len(cp.conns) != 1 {
+		t.Errorf("conns should be 1 but `%v`", len(cp.conns))
+	}
+}
+
+func TestConnectionPoolValidateWithoutLock(t *testing.T) {
+	cp := makeTestWaitPool(2)
+
+	_, free, _ := cp.Get(context.Background())
+	free()
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	cp.ValidateConnection = func(ctx context.Context, conn int) error {
+		close(entered)
+		<-release
+		return nil
+	}
+
+	got := make(chan error)
+	go func() {
+		_, free, err := cp.Get(context.Background())
+		if err == nil {
+			free()
+		}
+		got <- err
+	}()
+
+	<-entered
+
+	// pool is not locked while connection is validated
+	s := cp.Stats()
+	if s.InUse != 1 || s.Idle != 0 {
+		t.Errorf("connection should be in use while validated: %v", ToJson(s))
+	}
+
+	close(release)
+	if err := <-got; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionPoolTerminateWithoutLock(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	n := 0
+	cp := MakeConnectionPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context) (*Connection[int], error) {
+			n++
+			return MakeConnection(n,
+				func(ctx context.Context, conn int) error {
+					if conn != 1 {
+						return nil
+					}
+					select {
+					case entered <- struct{}{}:
+					default:
+					}
+					<-release
+					return fmt.Errorf("test terminate error")
+				},
+				nil,
+				func() time.Duration { return time.Second },
+			), nil
+		},
+		func() int { return 2 },
+		nil,
+	)
+	clock := fakeclock.New(time.Time{})
+	cp.SetClock(clock)
+	// expired connection is found by Get
+	cp.Reaper = nil
+
+	_, free, _ := cp.Get(context.Background())
+	free()
+	clock.Advance(time.Minute)
+
+	got := make(chan error)
+	go func() {
+		c, free, err := cp.Get(context.Background())
+		if err == nil {
+			if c.Conn != 2 {
+				t.Errorf("new connection should be generated instead of expired one")
+			}
+			free()
+		}
+		got <- err
+	}()
+
+	<-entered
+
+	// pool is not locked while expired connection is terminated
+	s := cp.Stats()
+	if s.OpenConnections != 1 || s.Idle != 0 {
+		t.Errorf("expired connection should be taken from idle while closed: %v", ToJson(s))
+	}
+
+	close(release)
+	if err := <-got; err != nil {
+		t.Fatal(err)
+	}
+
+	s = cp.Stats()
+	if s.TerminateErrors != 1 || s.OpenConnections != 2 || s.Idle != 2 {
+		t.Errorf("connection failed to close should stay in pool: %v", ToJson(s))
+	}
+}
+
+func TestConnectionPoolValidateIdleTimeout(t *testing.T) {
+	cp := MakeConnectionPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context) (*Connection[int], error) {
+			return MakeConnection(0,
+				func(ctx context.Context, conn int) error { return nil },
+				nil,
+				nil,
+			), nil
+		},
+		nil,
+		nil,
+	)
+
+	validated := 0
+	cp.ValidateConnection = func(ctx context.Context, conn int) error {
+		validated++
+		return nil
+	}
+	cp.ValidateIdleTimeout = time.Hour
+
+	_, free, _ := cp.Get(context.Background())
+	free()
+
+	conn, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	free()
+
+	if validated != 0 {
+		t.Errorf("validated should be 0 but `%v`", validated)
+	}
+
+	conn.LockDo(func() { conn.LastUseTime = conn.LastUseTime.Add(-2 * time.Hour) })
+
+	_, free, _ = cp.Get(context.Background())
+	free()
+
+	if validated != 1 {
+		t.Errorf("validated should be 1 but `%v`", validated)
+	}
+}
+
+func TestConnectionPoolShutdown(t *testing.T) {
+	terminated := 0
+	cp := MakeConnectionPool(
+		context.Background(),
+		nil,
+		func(ctxBase context.Context) (*Connection[int], error) {
+			return MakeConnection(0,
+				func(ctx context.Context, conn int) error {
+					terminated++
+					return nil
+				},
+				nil,
+				nil,
+			), nil
+		},
+		func() int { return 2 },
+		nil,
+	)
+
+	_, free1, _ := cp.Get(context.Background())
+	_, free2, _ := cp.Get(context.Background())
+
+	waitErr := make(chan error)
+	go func() {
+		_, _, err := cp.GetWait(context.Background())
+		waitErr <- err
+	}()
+	for cp.WaitersCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		free1()
+		free2()
+	}()
+
+	err := cp.Shutdown(context.Background())
+	if err != nil {
+		t.Errorf("shutdown err should be nil but `%v`", err)
+	}
+
+	if err := <-waitErr; !errors.Is(err, ErrClosedCP) {
+		t.Errorf("waiter err should be ErrClosedCP but `%v`", err)
+	}
+
+	cp.LockDo(func() {
+		if terminated != 2 || len(cp.conns) != 0 {
+			t.Errorf("all connections should be terminated but `%v` from `%v`", terminated, len(cp.conns))
+		}
+	})
+
+	_, _, err = cp.Get(context.Background())
+	if !errors.Is(err, ErrClosedCP) {
+		t.Errorf("get err should be ErrClosedCP but `%v`", err)
+	}
+}
+
+func TestConnectionPoolShutdownDeadline(t *testing.T) {
+	cp := MakeConnectionPool(
+		context.Background(),
+		nil,
+		func(ctxBase context.Context) (*Connection[int], error) {
+			return MakeConnection(0,
+				func(ctx context.Context, conn int) error { return fmt.Errorf("test terminate error") },
+				nil,
+				nil,
+			), nil
+		},
+		nil,
+		nil,
+	)
+
+	conn, free, _ := cp.Get(context.Background())
+	defer free()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	err := cp.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrConnTerminate) {
+		t.Errorf("shutdown err should be DeadlineExceeded and ErrConnTerminate but `%v`", err)
+	}
+
+	if conn.Stats().LastError != "test terminate error" {
+		t.Errorf("termination should be tried for connection in use")
+	}
+}
+
+func TestConnectionPoolMaxUsesAndJitter(t *testing.T) {
+	cp := makeTestWaitPool(1)
+	cp.MaxUses = 2
+	cp.ExpireJitter = time.Minute
+
+	c1, free, _ := cp.Get(context.Background())
+	free()
+
+	if c1.MaxUses != 2 || c1.OpenJitter < 0 || c1.OpenJitter >= time.Minute {
+		t.Errorf("connection should be set up by pool: %v %v", c1.MaxUses, c1.OpenJitter)
+	}
+
+	c2, free, _ := cp.Get(context.Background())
+	if c1.ID != c2.ID {
+		t.Errorf("connection should be reused before MaxUses")
+	}
+	free()
+
+	if !c1.CheckIsTerminated() || len(cp.conns) != 0 {
+		t.Errorf("connection should be retired after MaxUses")
+	}
+
+	c3, free, _ := cp.Get(context.Background())
+	defer free()
+	if c3.ID == c1.ID {
+		t.Errorf("new connection should be created after retire")
+	}
+}
+
+func TestConnectionPoolCreateWithoutLock(t *testing.T) {
+	dial := make(chan struct{})
+	cp := MakeConnectionPool(
+		context.Background(),
+		nil,
+		func(ctxBase context.Context) (*Connection[int], error) {
+			<-dial
+			return MakeConnection(0,
+				func(ctx context.Context, conn int) error { return nil },
+				nil,
+				nil,
+			), nil
+		},
+		func() int { return 3 },
+		nil,
+	)
+	cp.MaxCreating = func() int { return 1 }
+
+	go func() { dial <- struct{}{} }()
+	_, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	free()
+
+	slow := make(chan error)
+	go func() {
+		_, _, err := cp.GenerateConnection(context.Background())
+		slow <- err
+	}()
+
+	for cp.Stats().Creating != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, _, err = cp.GenerateConnection(context.Background())
+	if !errors.Is(err, ErrCreatingLimitCP) {
+		t.Errorf("err should be ErrCreatingLimitCP but `%v`", err)
+	}
+
+	// idle connection is available while other connection is generating
+	_, free, err = cp.Get(context.Background())
+	if err != nil {
+		t.Fatalf("idle connection should be got while generating but `%v`", err)
+	}
+
+	cp.LockDo(func() { cp.MaxCount = func() int { return 2 } })
+
+	_, _, err = cp.Get(context.Background())
+	if !errors.Is(err, ErrOverflowCP) {
+		t.Errorf("generating connection should be counted to MaxCount but `%v`", err)
+	}
+
+	free()
+
+	dial <- struct{}{}
+	if err := <-slow; err != nil {
+		t.Error(err)
+	}
+
+	s := cp.Stats()
+	if s.Creating != 0 || s.OpenConnections != 2 {
+		t.Errorf("wrong pool state: %v", ToJson(s))
+	}
+}
+
+func TestConnectionPoolReaper(t *testing.T) {
+	cp := MakeConnectionPool(
+		context.Background(),
+		nil,
+		func(ctxBase context.Context) (*Connection[int], error) {
+			return MakeConnection(0,
+				func(ctx context.Context, conn int) error { return nil },
+				nil,
+				func() time.Duration { return 2 * time.Millisecond },
+			), nil
+		},
+		nil,
+		nil,
+	)
+	clock := fakeclock.New(time.Time{})
+	cp.SetClock(clock)
+
+	conn, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	free()
+
+	if cp.Reaper.Len() != 1 {
+		t.Errorf("connection expiration should be scheduled")
+	}
+
+	clock.Advance(time.Millisecond)
+	if conn.CheckIsTerminated() {
+		t.Errorf("connection should not be closed before expire")
+	}
+
+	clock.Advance(time.Millisecond)
+
+	if !conn.CheckIsTerminated() {
+		t.Errorf("connection should be closed by reaper")
+	}
+	if s := cp.Stats(); s.OpenConnections != 0 || s.Expired != 1 {
+		t.Errorf("wrong pool stats: %v", ToJson(s))
+	}
+}
+
+func TestConnectionPoolHooks(t *testing.T) {
+	cp := makeTestWaitPool(3)
+
+	var events []string
+	failReturn := false
+	cp.OnCreate = func(ctx context.Context, conn int) error {
+		events = append(events, fmt.Sprintf("create %v", conn))
+		return nil
+	}
+	cp.OnBorrow = func(ctx context.Context, conn int) error {
+		events = append(events, fmt.Sprintf("borrow %v", conn))
+		return nil
+	}
+	cp.OnReturn = func(ctx context.Context, conn int) error {
+		events = append(events, fmt.Sprintf("return %v", conn))
+		if failReturn {
+			return fmt.Errorf("test reset error")
+		}
+		return nil
+	}
+	cp.OnClose = func(ctx context.Context, conn int) {
+		events = append(events, fmt.Sprintf("close %v", conn))
+	}
+
+	conn, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	free()
+
+	_, free, err = cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	failReturn = true
+	free()
+
+	if !conn.CheckIsTerminated() {
+		t.Errorf("connection should be terminated after failed OnReturn")
+	}
+	if s := cp.Stats(); s.OpenConnections != 0 {
+		t.Errorf("connection should be removed: %v", ToJson(s))
+	}
+
+	expected := "create 1,borrow 1,return 1,borrow 1,return 1,close 1"
+	if strings.Join(events, ",") != expected {
+		t.Errorf("wrong hooks order `%v` expected `%v`", strings.Join(events, ","), expected)
+	}
+}
+
+func TestConnectionPoolHooksCreateFail(t *testing.T) {
+	cp := makeTestWaitPool(3)
+
+	closed := 0
+	cp.OnCreate = func(ctx context.Context, conn int) error {
+		return fmt.Errorf("test setup error")
+	}
+	cp.OnClose = func(ctx context.Context, conn int) {
+		closed++
+	}
+
+	_, _, err := cp.Get(context.Background())
+	if !errors.Is(err, ErrConnectionCreationErrorCP) || !errors.Is(err, ErrConnectionHookCP) {
+		t.Fatalf("creation hook error expected but `%v`", err)
+	}
+	if closed != 1 {
+		t.Errorf("connection should be closed once but `%v`", closed)
+	}
+	if s := cp.Stats(); s.OpenConnections != 0 || s.CreateErrors != 1 || s.Creating != 0 {
+		t.Errorf("wrong pool stats: %v", ToJson(s))
+	}
+}
+
+func TestConnectionPoolHooksBorrowFail(t *testing.T) {
+	cp := makeTestWaitPool(3)
+
+	conn1, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	free()
+
+	cp.OnBorrow = func(ctx context.Context, conn int) error {
+		if conn == 1 {
+			return fmt.Errorf("test borrow error")
+		}
+		return nil
+	}
+
+	conn2, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer free()
+
+	if conn2.Conn != 2 {
+		t.Errorf("new connection expected but `%v`", conn2.Conn)
+	}
+	if !conn1.CheckIsTerminated() {
+		t.Errorf("connection with failed OnBorrow should be terminated")
+	}
+}
+
+func TestConnectionPoolHooksBorrowWithoutLock(t *testing.T) {
+	cp := makeTestWaitPool(1)
+
+	conn, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	cp.OnBorrow = func(ctx context.Context, conn int) error {
+		close(entered)
+		<-release
+		return nil
+	}
+
+	got := make(chan *Connection[int])
+	go func() {
+		c, free, err := cp.GetWait(context.Background())
+		if err != nil {
+			t.Error(err)
+		} else {
+			free()
+		}
+		got <- c
+	}()
+	waitWaitersCount(t, cp, 1)
+
+	// release hands connection to waiter and OnBorrow runs in waiter without pool lock
+	free()
+	<-entered
+
+	if s := cp.Stats(); s.InUse != 1 || s.Waiters != 0 {
+		t.Errorf("connection should be handed to waiter: %v", ToJson(s))
+	}
+
+	close(release)
+	if c := <-got; c == nil || c.ID != conn.ID {
+		t.Errorf("waiter should get released connection")
+	}
+}
+
+func TestConnectionPoolGenerateCallerDeadline(t *testing.T) {
+	var ctxGen context.Context
+	slow := false
+	terminated := make(chan int, 1)
+	n := 0
+	cp := MakeConnectionPool(
+		context.Background(),
+		nil,
+		func(ctxBase context.Context) (*Connection[int], error) {
+			if slow {
+				// hung backend ignores context
+				time.Sleep(30 * time.Millisecond)
+			} else {
+				select {
+				case <-ctxBase.Done():
+					return nil, context.Cause(ctxBase)
+				case <-time.After(time.Millisecond):
+				}
+			}
+			n++
+			ctxGen = ctxBase
+			return MakeConnection(n,
+				func(ctx context.Context, conn int) error {
+					terminated <- conn
+					return nil
+				},
+				nil,
+				nil,
+			), nil
+		},
+		nil,
+		nil,
+	)
+	cp.Breaker = MakeCircuitBreaker(1, time.Second, time.Second)
+
+	conn, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	free()
+	if ctxGen.Err() != nil {
+		t.Errorf("context of connection should live until connection is terminated")
+	}
+	err = cp.RemoveInternal(context.Background(), conn.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-terminated
+	if ctxGen.Err() == nil {
+		t.Errorf("context of connection should be canceled after termination")
+	}
+
+	slow = true
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err = cp.Get(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("deadline error expected but `%v`", err)
+	}
+	if conn := <-terminated; conn != 2 {
+		t.Errorf("connection generated after caller gave up should be terminated but `%v`", conn)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("too long generation")
+	}
+	if s := cp.Stats(); s.OpenConnections != 0 || s.Creating != 0 {
+		t.Errorf("wrong pool stats: %v", ToJson(s))
+	}
+	if cp.Breaker.State() != BreakerClosed {
+		t.Errorf("caller cancel should not open breaker")
+	}
+}
+
+func TestConnectionPoolGenerateCallerCancel(t *testing.T) {
+	cp := MakeConnectionPool(
+		context.Background(),
+		nil,
+		func(ctxBase context.Context) (*Connection[int], error) {
+			<-ctxBase.Done()
+			return nil, context.Cause(ctxBase)
+		},
+		nil,
+		nil,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := cp.Get(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("deadline error expected but `%v`", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("generation should observe caller deadline")
+	}
+}
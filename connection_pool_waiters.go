@@ -0,0 +1,276 @@
+package poh
+
+import (
+	"container/list"
+	"context"
+	"errors"
+
+	"github.com/myfantasy/mfctx"
+)
+
+// connWaiter - GetWait caller waiting in queue for connection
+type connWaiter[T any] struct {
+	ctx      context.Context
+	priority int
+	// n - count of connections waiter needs at once (GetN)
+	n int
+
+	// ch receives exactly one grant; it is buffered so grant never blocks pool
+	ch   chan connGrant[T]
+	elem *list.Element
+}
+
+// connGrant - connection or reserved slot handed to waiter; free is without pool lock
+type connGrant[T any] struct {
+	conn *Connection[T]
+	free FreeConnectionFunc
+	// reserved - slot is reserved for waiter and waiter should create connection by createReserved
+	reserved bool
+	// items - connections and reserved slots of GetN waiter
+	items []connGrant[T]
+	// check - idle connection should be checked by checkBorrowed without pool lock before use
+	check bool
+	// validate - idle connection should be validated by check
+	validate bool
+	// unlock - unlocks connection without return to pool (when check fails)
+	unlock FreeConnectionFunc
+	err    error
+}
+
+// isWaitableErr - error means caller may wait for released or created connection
+func isWaitableErr(err error) bool {
+	return errors.Is(err, ErrOverflowCP) ||
+		errors.Is(err, ErrCreatingLimitCP) ||
+		errors.Is(err, ErrRateLimitCP) ||
+		errors.Is(err, ErrConnectionCreationErrorCP) ||
+		errors.Is(err, ErrConnectionValidationCP) ||
+		errors.Is(err, ErrConnectionHookCP)
+}
+
+// retryWaitersInternal - serves waiters again when grant was not used because idle connection failed check
+// (slot of removed connection is free) or after CheckTimeout when connection creation failed
+// (so waiter does not wait for release of other connection); without lock
+func (cp *ConnectionPool[T]) retryWaitersInternal(err error) {
+	if errors.Is(err, ErrConnectionCreationErrorCP) {
+		d := cp.CheckTimeout
+		if d <= 0 {
+			d = DefaultConnectionPoolCheckTimeout
+		}
+		cp.wakeWaitersInternal(d)
+	}
+	if errors.Is(err, ErrConnectionValidationCP) || errors.Is(err, ErrConnectionHookCP) {
+		cp.ServeWaitersInternal()
+	}
+}
+
+// GetWait - gets connection or waits in queue while pool is overflowed or connection creation fails;
+// queue is ordered by priority of caller (see WithPriority) and FIFO for the same priority
+func (cp *ConnectionPool[T]) GetWait(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.ConnectionPool.GetWait")
+	defer func() { ctx.Complete(err) }()
+
+	start := cp.now()
+	defer func() { cp.acquireDone(ctxIn, start, err) }()
+
+	cp.mx.Lock()
+
+	priority := PriorityFromCtx(ctxIn)
+
+	err = ErrOverflowCP
+	for !cp.hasWaitersBeforeInternal(priority) {
+		var g connGrant[T]
+		g, err = cp.getInternal(ctxIn, true)
+		if err != nil {
+			if !isWaitableErr(err) {
+				cp.unlock()
+				return nil, freeConnectionFuncEmpty, err
+			}
+			break
+		}
+
+		cp.unlock()
+
+		if g.reserved {
+			conn, free, err = cp.createReserved(ctxIn)
+			if err == nil || !isWaitableErr(err) || ctxIn.Err() != nil {
+				return conn, free, err
+			}
+			cp.mx.Lock()
+			break
+		}
+
+		if cp.checkOrDrop(ctxIn, g) {
+			return g.conn, cp.lockedFree(g.conn, g.free), nil
+		}
+
+		cp.mx.Lock()
+	}
+
+	w := &connWaiter[T]{
+		ctx:      ctxIn,
+		priority: priority,
+		n:        1,
+		ch:       make(chan connGrant[T], 1),
+	}
+	cp.enqueueInternal(w, false)
+	cp.retryWaitersInternal(err)
+	cp.counters.waitCount++
+	waitStart := cp.now()
+	defer cp.LockDo(func() { cp.counters.waitDuration += cp.now().Sub(waitStart) })
+
+	cp.unlock()
+
+	for {
+		select {
+		case g := <-w.ch:
+			if g.err != nil {
+				return nil, freeConnectionFuncEmpty, g.err
+			}
+			if !g.reserved {
+				errC := cp.checkBorrowed(ctxIn, g)
+				if errC == nil {
+					return g.conn, cp.lockedFree(g.conn, g.free), nil
+				}
+
+				// connection failed check so wait again first in queue
+				err = errC
+				cp.mx.Lock()
+				if !cp.closed {
+					cp.enqueueInternal(w, true)
+				}
+				cp.dropBorrowedInternal(ctxIn, g, errC)
+				closed := cp.closed
+				cp.unlock()
+
+				if closed {
+					return nil, freeConnectionFuncEmpty, ErrClosedCP
+				}
+
+				continue
+			}
+
+			conn, free, err = cp.createReserved(ctxIn)
+			if err == nil || !isWaitableErr(err) || ctxIn.Err() != nil {
+				return conn, free, err
+			}
+
+			// creation failed so wait again first in queue
+			cp.mx.Lock()
+			if cp.closed {
+				cp.unlock()
+				return nil, freeConnectionFuncEmpty, ErrClosedCP
+			}
+			cp.enqueueInternal(w, true)
+			cp.retryWaitersInternal(err)
+			cp.unlock()
+
+			continue
+		case <-ctxIn.Done():
+		}
+
+		break
+	}
+
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	if w.elem != nil {
+		cp.waiters.Remove(w.elem)
+		w.elem = nil
+	} else {
+		// grant was sent before cancel so give connection or slot back
+		cp.giveBackInternal(<-w.ch)
+		cp.ServeWaitersInternal()
+	}
+
+	return nil, freeConnectionFuncEmpty, errors.Join(err, context.Cause(ctxIn))
+}
+
+// ServeWaitersInternal - hands idle connections or reserved slots to waiters in queue order; without lock
+func (cp *ConnectionPool[T]) ServeWaitersInternal() {
+	// connections given back while serving (GetN rollback) are served by outer call
+	if cp.serving {
+		return
+	}
+	cp.serving = true
+	defer func() { cp.serving = false }()
+
+	for cp.waiters.Len() > 0 {
+		w := cp.waiters.Front().Value.(*connWaiter[T])
+
+		var g connGrant[T]
+		var err error
+		if w.n > 1 {
+			g.items, err = cp.getNInternal(w.ctx, w.n)
+		} else {
+			g, err = cp.getInternal(w.ctx, true)
+		}
+		if err != nil {
+			return
+		}
+
+		cp.waiters.Remove(w.elem)
+		w.elem = nil
+
+		w.ch <- g
+	}
+}
+
+// giveBackInternal - returns connections and reserved slots of grant that was not used; without lock
+func (cp *ConnectionPool[T]) giveBackInternal(g connGrant[T]) {
+	if g.err != nil {
+		return
+	}
+
+	for _, item := range g.items {
+		cp.giveBackInternal(item)
+	}
+
+	if g.reserved {
+		cp.pending--
+		if cp.Breaker != nil {
+			cp.Breaker.Cancel()
+		}
+		if cp.RateLimit != nil {
+			cp.RateLimit.Cancel()
+		}
+	} else if g.conn != nil {
+		g.free()
+	}
+}
+
+// RejectWaitersInternal - removes all waiters from queue and returns err to them; without lock
+func (cp *ConnectionPool[T]) RejectWaitersInternal(err error) {
+	for cp.waiters.Len() > 0 {
+		w := cp.waiters.Front().Value.(*connWaiter[T])
+
+		cp.waiters.Remove(w.elem)
+		w.elem = nil
+
+		w.ch <- connGrant[T]{err: err}
+	}
+}
+
+// WaitersCount - returns count of GetWait callers in queue
+func (cp *ConnectionPool[T]) WaitersCount() int {
+	cp.mx.Lock()
+	defer cp.unlock()
+
+	return cp.waiters.Len()
+}
+
+// lockedFree - wraps free without pool lock; runs OnReturn (without pool lock) and marks connection broken when it fails
+func (cp *ConnectionPool[T]) lockedFree(c *Connection[T], f FreeConnectionFunc) FreeConnectionFunc {
+	return func() {
+		if c != nil && cp.OnReturn != nil {
+			err := cp.runHook(cp.ctxBase, cp.OnReturn, c)
+			if err != nil {
+				c.MarkBroken(err)
+			}
+		}
+
+		cp.mx.Lock()
+		defer cp.unlock()
+		f()
+	}
+}
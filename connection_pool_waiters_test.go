@@ -0,0 +1,231 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
+)
+
+func makeTestWaitPool(maxCount int) *ConnectionPool[int] {
+	n := 0
+	return MakeConnectionPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context) (*Connection[int], error) {
+			n++
+			return MakeConnection(n,
+				func(ctx context.Context, conn int) error { return nil },
+				nil,
+				nil,
+			), nil
+		},
+		func() int { return maxCount },
+		nil,
+	)
+}
+
+func waitWaitersCount(t *testing.T, cp *ConnectionPool[int], cnt int) {
+	for i := 0; i < 1000; i++ {
+		if cp.WaitersCount() == cnt {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("waiters should be %v but `%v`", cnt, cp.WaitersCount())
+}
+
+func TestConnectionPoolGetWaitFIFO(t *testing.T) {
+	cp := makeTestWaitPool(1)
+
+	conn, free, err := cp.GetWait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = cp.Get(context.Background())
+	if !errors.Is(err, ErrOverflowCP) {
+		t.Errorf("err should be ErrOverflowCP but `%v`", err)
+	}
+
+	order := make(chan int, 2)
+	frees := make(chan FreeConnectionFunc, 2)
+	for i := 1; i <= 2; i++ {
+		go func(i int) {
+			c, f, err := cp.GetWait(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if c.ID != conn.ID {
+				t.Errorf("waiter %v should get released connection", i)
+			}
+			order <- i
+			frees <- f
+		}(i)
+		waitWaitersCount(t, cp, i)
+	}
+
+	free()
+
+	if i := <-order; i != 1 {
+		t.Errorf("first served waiter should be 1 but `%v`", i)
+	}
+	if cp.WaitersCount() != 1 {
+		t.Errorf("waiters should be 1 but `%v`", cp.WaitersCount())
+	}
+
+	(<-frees)()
+
+	if i := <-order; i != 2 {
+		t.Errorf("second served waiter should be 2 but `%v`", i)
+	}
+
+	(<-frees)()
+
+	if len(cp.free) != 1 {
+		t.Errorf("free should be 1 but `%v`", len(cp.free))
+	}
+}
+
+func TestConnectionPoolGetWaitCancel(t *testing.T) {
+	cp := makeTestWaitPool(1)
+
+	_, free, err := cp.GetWait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	_, _, err = cp.GetWait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrOverflowCP) {
+		t.Errorf("err should be DeadlineExceeded and ErrOverflowCP but `%v`", err)
+	}
+
+	if cp.WaitersCount() != 0 {
+		t.Errorf("waiters should be 0 after cancel but `%v`", cp.WaitersCount())
+	}
+
+	free()
+
+	_, free, err = cp.Get(context.Background())
+	if err != nil {
+		t.Errorf("connection should be free after canceled waiter but `%v`", err)
+	}
+	free()
+}
+
+func TestConnectionPoolGetWaitFailedDialServesWaiter(t *testing.T) {
+	dialing := make(chan struct{})
+	fail := make(chan struct{})
+	var mx sync.Mutex
+	n := 0
+	cp := MakeConnectionPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context) (*Connection[int], error) {
+			mx.Lock()
+			n++
+			i := n
+			mx.Unlock()
+
+			if i == 1 {
+				close(dialing)
+				<-fail
+				return nil, fmt.Errorf("test dial error")
+			}
+			return MakeConnection(i,
+				func(ctx context.Context, conn int) error { return nil },
+				nil,
+				nil,
+			), nil
+		},
+		func() int { return 2 },
+		nil,
+	)
+	cp.MaxCreating = func() int { return 1 }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first := make(chan error)
+	go func() {
+		_, free, err := cp.GetWait(ctx)
+		if err == nil {
+			free()
+		}
+		first <- err
+	}()
+	<-dialing
+
+	second := make(chan error)
+	go func() {
+		_, free, err := cp.GetWait(ctx)
+		if err == nil {
+			free()
+		}
+		second <- err
+	}()
+	waitWaitersCount(t, cp, 1)
+
+	close(fail)
+
+	// slot of failed dial is handed to queued waiter
+	if err := <-second; err != nil {
+		t.Errorf("queued waiter should get connection but `%v`", err)
+	}
+	if err := <-first; err != nil {
+		t.Errorf("caller of failed dial should get connection but `%v`", err)
+	}
+}
+
+func TestConnectionPoolGetWaitRetriesFailedDial(t *testing.T) {
+	var mx sync.Mutex
+	n := 0
+	cp := MakeConnectionPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context) (*Connection[int], error) {
+			mx.Lock()
+			defer mx.Unlock()
+
+			n++
+			if n == 1 {
+				return nil, fmt.Errorf("test dial error")
+			}
+			return MakeConnection(n,
+				func(ctx context.Context, conn int) error { return nil },
+				nil,
+				nil,
+			), nil
+		},
+		func() int { return 1 },
+		nil,
+	)
+	clock := fakeclock.New(time.Time{})
+	cp.SetClock(clock)
+	cp.CheckTimeout = time.Second
+
+	got := make(chan error)
+	go func() {
+		_, free, err := cp.GetWait(context.Background())
+		if err == nil {
+			free()
+		}
+		got <- err
+	}()
+
+	// failed creation is retried after CheckTimeout without maintenance job
+	clock.WaitTimers(1)
+	clock.Advance(time.Second)
+
+	if err := <-got; err != nil {
+		t.Errorf("waiter should get connection after retry but `%v`", err)
+	}
+}
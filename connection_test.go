@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"testing"
 	"time"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
 )
 
 func TestConnection(t *testing.T) {
@@ -109,6 +111,8 @@ func TestConnectionCloseByTimeout(t *testing.T) {
 		nil,
 		nil,
 	)
+	clock := fakeclock.New(time.Time{})
+	cnct.SetClock(clock)
 
 	ok := cnct.CheckExpired()
 
@@ -116,7 +120,7 @@ func TestConnectionCloseByTimeout(t *testing.T) {
 		t.Errorf("connect should be not expired")
 	}
 
-	time.Sleep(time.Millisecond)
+	clock.Advance(time.Millisecond)
 
 	cnct.OpenExpire = func() time.Duration { return 0 }
 
@@ -167,6 +171,8 @@ func TestConnectionCloseByIdleTimeout(t *testing.T) {
 		nil,
 		nil,
 	)
+	clock := fakeclock.New(time.Time{})
+	cnct.SetClock(clock)
 
 	ok := cnct.CheckIdleExpired()
 
@@ -174,7 +180,7 @@ func TestConnectionCloseByIdleTimeout(t *testing.T) {
 		t.Errorf("connect should be not expired idle")
 	}
 
-	time.Sleep(time.Millisecond)
+	clock.Advance(time.Millisecond)
 
 	cnct.IdleExpire = func() time.Duration { return 0 }
 
@@ -220,15 +226,21 @@ func TestConnectionCloseByIdleTimeout(t *testing.T) {
 }
 
 func TestConnectionCloseRunOpen(t *testing.T) {
+	terminated := make(chan struct{})
 	cnct := MakeConnection(struct{}{},
-		func(ctx context.Context, conn struct{}) error { return nil },
+		func(ctx context.Context, conn struct{}) error { close(terminated); return nil },
 		func() time.Duration { return time.Microsecond },
 		nil,
 	)
+	clock := fakeclock.New(time.Time{})
+	cnct.SetClock(clock)
 
 	cnct.CloseJobRun(context.Background(), time.Millisecond)
 
-	time.Sleep(2 * time.Millisecond)
+	clock.WaitTimers(1)
+	clock.Advance(time.Millisecond)
+	// terminate runs under connection lock so CheckIsTerminated waits for close is completed
+	<-terminated
 
 	if !cnct.CheckIsTerminated() {
 		t.Errorf("connect should be closed")
@@ -236,15 +248,21 @@ func TestConnectionCloseRunOpen(t *testing.T) {
 }
 
 func TestConnectionCloseRunIdle(t *testing.T) {
+	terminated := make(chan struct{})
 	cnct := MakeConnection(struct{}{},
-		func(ctx context.Context, conn struct{}) error { return nil },
+		func(ctx context.Context, conn struct{}) error { close(terminated); return nil },
 		nil,
 		func() time.Duration { return time.Microsecond },
 	)
+	clock := fakeclock.New(time.Time{})
+	cnct.SetClock(clock)
 
 	cnct.CloseJobRun(context.Background(), time.Millisecond)
 
-	time.Sleep(2 * time.Millisecond)
+	clock.WaitTimers(1)
+	clock.Advance(time.Millisecond)
+	// terminate runs under connection lock so CheckIsTerminated waits for close is completed
+	<-terminated
 
 	if !cnct.CheckIsTerminated() {
 		t.Errorf("connect should be closed")
@@ -285,3 +303,83 @@ func TestConnectionTerminate(t *testing.T) {
 		t.Errorf("connect should be terminated")
 	}
 }
+
+func TestConnectionCanUseIdleExpired(t *testing.T) {
+	cnct := MakeConnection(struct{}{},
+		func(ctx context.Context, conn struct{}) error { return nil },
+		nil,
+		func() time.Duration { return time.Nanosecond },
+	)
+	clock := fakeclock.New(time.Time{})
+	cnct.SetClock(clock)
+
+	if !cnct.CanUse() {
+		t.Errorf("connection should be in can use before idle expire")
+	}
+
+	clock.Advance(time.Millisecond)
+
+	if cnct.CanUse() {
+		t.Errorf("idle expired connection should be not in can use")
+	}
+}
+
+func TestConnectionMaxUses(t *testing.T) {
+	cnct := MakeConnection(struct{}{},
+		func(ctx context.Context, conn struct{}) error { return nil },
+		nil,
+		nil,
+	)
+	cnct.MaxUses = 2
+
+	for i := 0; i < 2; i++ {
+		ok, free := cnct.TryLock(context.Background())
+		if !ok {
+			t.Fatalf("lock %v should be start", i)
+		}
+		free()
+	}
+
+	ok, _ := cnct.TryLock(context.Background())
+	if ok {
+		t.Error("lock should be fail after MaxUses")
+	}
+
+	doClose, err := cnct.CheckAndClose(context.Background())
+	if !doClose || err != nil {
+		t.Errorf("connection should be closed after MaxUses but `%v` `%v`", doClose, err)
+	}
+}
+
+func TestConnectionExpireJitter(t *testing.T) {
+	cnct := MakeConnection(struct{}{},
+		func(ctx context.Context, conn struct{}) error { return nil },
+		func() time.Duration { return time.Hour },
+		func() time.Duration { return time.Hour },
+	)
+
+	cnct.LockDo(func() {
+		cnct.StartTime = cnct.StartTime.Add(-50 * time.Minute)
+		cnct.LastUseTime = cnct.LastUseTime.Add(-50 * time.Minute)
+	})
+
+	if cnct.CheckExpired() || cnct.CheckIdleExpired() {
+		t.Fatal("connection should be not expired without jitter")
+	}
+
+	cnct.LockDo(func() {
+		cnct.OpenJitter = 20 * time.Minute
+	})
+
+	if !cnct.CheckExpired() || cnct.CheckIdleExpired() {
+		t.Error("connection should be expired by open jitter only")
+	}
+
+	cnct.LockDo(func() {
+		cnct.IdleJitter = 2 * time.Hour
+	})
+
+	if cnct.CheckIdleExpired() {
+		t.Error("jitter greater than expire should be ignored")
+	}
+}
@@ -0,0 +1,181 @@
+package poh
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// DebugPool - pool shown by DebugHandler (*ConnectionPool)
+type DebugPool interface {
+	Stats() ConnectionPoolStats
+	ConnectionsStats() []ConnectionStats
+}
+
+// DebugHub - hub shown by DebugHandler (*Hub)
+type DebugHub interface {
+	Stats() HubStats
+}
+
+// DebugPoolState - state of pool rendered by DebugHandler
+type DebugPoolState struct {
+	Stats       ConnectionPoolStats `json:"stats"`
+	Connections []ConnectionStats   `json:"connections"`
+}
+
+// DebugState - state of registered pools and hubs rendered by DebugHandler
+type DebugState struct {
+	Pools map[string]DebugPoolState `json:"pools"`
+	Hubs  map[string]HubStats       `json:"hubs"`
+}
+
+// DebugHandler - http.Handler that renders state of registered pools and hubs
+// as JSON or as plain text (query format=text or Accept: text/plain)
+type DebugHandler struct {
+	pools map[string]DebugPool
+	hubs  map[string]DebugHub
+
+	mx sync.Mutex
+}
+
+func MakeDebugHandler() *DebugHandler {
+	return &DebugHandler{
+		pools: make(map[string]DebugPool),
+		hubs:  make(map[string]DebugHub),
+	}
+}
+
+// AddPool - registers pool with name (replaces pool with the same name)
+func (h *DebugHandler) AddPool(name string, pool DebugPool) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.pools[name] = pool
+}
+
+// AddHub - registers hub with name (replaces hub with the same name)
+func (h *DebugHandler) AddHub(name string, hub DebugHub) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.hubs[name] = hub
+}
+
+// Remove - unregisters pool and hub with name
+func (h *DebugHandler) Remove(name string) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	delete(h.pools, name)
+	delete(h.hubs, name)
+}
+
+// State - returns state of registered pools and hubs; connections are sorted by StartTime
+func (h *DebugHandler) State() DebugState {
+	h.mx.Lock()
+	pools := make(map[string]DebugPool, len(h.pools))
+	for name, p := range h.pools {
+		pools[name] = p
+	}
+	hubs := make(map[string]DebugHub, len(h.hubs))
+	for name, hub := range h.hubs {
+		hubs[name] = hub
+	}
+	h.mx.Unlock()
+
+	res := DebugState{
+		Pools: make(map[string]DebugPoolState, len(pools)),
+		Hubs:  make(map[string]HubStats, len(hubs)),
+	}
+
+	for name, p := range pools {
+		conns := p.ConnectionsStats()
+		sort.Slice(conns, func(i, j int) bool {
+			if conns[i].StartTime.Equal(conns[j].StartTime) {
+				return conns[i].ID < conns[j].ID
+			}
+			return conns[i].StartTime.Before(conns[j].StartTime)
+		})
+		res.Pools[name] = DebugPoolState{Stats: p.Stats(), Connections: conns}
+	}
+
+	for name, hub := range hubs {
+		res.Hubs[name] = hub.Stats()
+	}
+
+	return res
+}
+
+func (h *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	state := h.State()
+
+	if r.URL.Query().Get("format") == "text" ||
+		r.URL.Query().Get("format") == "" && strings.HasPrefix(r.Header.Get("Accept"), "text/plain") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeDebugText(w, state)
+		return
+	}
+
+	// state is marshaled before headers are written so error is returned as 500
+	body, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func formatDebugTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func writeDebugText(w http.ResponseWriter, state DebugState) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	defer tw.Flush()
+
+	for _, name := range sortedKeys(state.Pools) {
+		p := state.Pools[name]
+		s := p.Stats
+		fmt.Fprintf(tw, "pool %v: open %v/%v in use %v idle %v waiters %v creating %v\n",
+			name, s.OpenConnections, s.MaxOpenConnections, s.InUse, s.Idle, s.Waiters, s.Creating)
+		fmt.Fprintf(tw, "ID\tIN USE\tUSED\tSTART\tLAST USE\tEXPIRE\tLAST ERROR\n")
+		for _, c := range p.Connections {
+			expire := "-"
+			if c.ExpireTime != nil {
+				expire = formatDebugTime(*c.ExpireTime)
+			}
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", c.ID, c.InUse, c.UsedQty,
+				formatDebugTime(c.StartTime), formatDebugTime(c.LastUseTime), expire, c.LastError)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	for _, name := range sortedKeys(state.Hubs) {
+		hub := state.Hubs[name]
+		fmt.Fprintf(tw, "hub %v: keys loaded %v %v\n", name, formatDebugTime(hub.KeysLoaded.Time), hub.KeysLoaded.Error)
+		fmt.Fprintf(tw, "KEY\tEXISTS\tLAST REFRESH\tERROR\n")
+		for _, p := range hub.Points {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", p.Key, p.Exists, formatDebugTime(p.LastRefresh.Time), p.LastRefresh.Error)
+		}
+		fmt.Fprintln(tw)
+	}
+}
@@ -0,0 +1,101 @@
+package poh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/mfctx"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
+)
+
+func TestDebugHandler(t *testing.T) {
+	cp := MakeConnectionPool(
+		context.Background(),
+		nil,
+		func(ctxBase context.Context) (*Connection[int], error) {
+			return MakeConnection(0,
+				func(ctx context.Context, conn int) error { return nil },
+				func() time.Duration { return time.Hour },
+				nil,
+			), nil
+		},
+		func() int { return 3 },
+		nil,
+	)
+	conn, free, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer free()
+
+	hub := MakeHub[string, string](
+		context.Background(),
+		func(ctx context.Context) (keys []string, err error) {
+			return []string{"a", "b"}, nil
+		},
+		func(ctx context.Context, key string, point string) (err error) {
+			return nil
+		},
+		func(ctx context.Context, key string) (point string, err error) {
+			if key == "b" {
+				return "", fmt.Errorf("test generate error")
+			}
+			return key, nil
+		},
+		func(ctx context.Context, key string, point string) (err error) {
+			return nil
+		},
+	)
+	clock := fakeclock.New(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	hub.Clock = clock
+	hub.refreshPoint(mfctx.FromCtx(context.Background()), "a")
+	hub.refreshPoint(mfctx.FromCtx(context.Background()), "b")
+
+	h := MakeDebugHandler()
+	h.AddPool("db", cp)
+	h.AddHub("shards", hub)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/poh", nil))
+
+	var state DebugState
+	err = json.Unmarshal(rec.Body.Bytes(), &state)
+	if err != nil {
+		t.Fatalf("json expected: %v\n%v", err, rec.Body.String())
+	}
+
+	p := state.Pools["db"]
+	if p.Stats.InUse != 1 || len(p.Connections) != 1 || p.Connections[0].ID != conn.ID ||
+		!p.Connections[0].InUse || p.Connections[0].ExpireTime == nil {
+		t.Errorf("wrong pool state: %v", rec.Body.String())
+	}
+
+	hs := state.Hubs["shards"]
+	if len(hs.Points) != 2 || !hs.Points[0].Exists || hs.Points[1].Exists ||
+		!strings.Contains(hs.Points[1].LastRefresh.Error, "test generate error") ||
+		!hs.Points[0].LastRefresh.Time.Equal(clock.Now()) {
+		t.Errorf("wrong hub state: %v", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/poh?format=text", nil))
+
+	text := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") ||
+		!strings.Contains(text, "pool db: open 1/3 in use 1") ||
+		!strings.Contains(text, conn.ID) ||
+		!strings.Contains(text, "test generate error") {
+		t.Errorf("wrong text view:\n%v", text)
+	}
+
+	h.Remove("db")
+	if _, ok := h.State().Pools["db"]; ok {
+		t.Errorf("pool should be removed")
+	}
+}
@@ -8,3 +8,22 @@ var ErrConnTerminate = fmt.Errorf("conection terminate fail")
 var ErrInternalLockCP = fmt.Errorf("conection pool internal lock error")
 var ErrOverflowCP = fmt.Errorf("conection pool overflow")
 var ErrConnectionCreationErrorCP = fmt.Errorf("conection create fail")
+var ErrConnectionValidationCP = fmt.Errorf("conection validation fail")
+var ErrConnectionHookCP = fmt.Errorf("conection hook fail")
+var ErrConnectionKeepaliveCP = fmt.Errorf("conection keepalive fail")
+var ErrClosedCP = fmt.Errorf("conection pool closed")
+var ErrCreatingLimitCP = fmt.Errorf("conection pool creating limit")
+var ErrRateLimitCP = fmt.Errorf("conection pool creation rate limit")
+var ErrNoEndpointCP = fmt.Errorf("conection pool has no available endpoint")
+var ErrEndpointRemovedCP = fmt.Errorf("conection endpoint is removed")
+var ErrTooManyCP = fmt.Errorf("conection pool can not give so many conections at once")
+var ErrReclaimedCP = fmt.Errorf("conection was reclaimed by pool")
+
+var ErrBreakerOpen = fmt.Errorf("circuit breaker is open")
+
+var ErrSQLIsolationLevel = fmt.Errorf("sql conection does not support non-default isolation level")
+var ErrSQLReadOnly = fmt.Errorf("sql conection does not support read-only transactions")
+var ErrSQLNamedParams = fmt.Errorf("sql conection does not support named parameters")
+
+// ErrBrokenConnection - wrap error of connection use to terminate connection on release
+var ErrBrokenConnection = fmt.Errorf("conection is broken")
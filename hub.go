@@ -2,7 +2,10 @@ package poh
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/myfantasy/mfctx"
 )
@@ -22,9 +25,46 @@ type Hub[K comparable, T any] struct {
 	pointGenerate  PointGenerateFunc[K, T]
 	pointRefresh   PointRefreshFunc[K, T]
 
+	metrics *hubMetrics
+
+	// Clock - source of time of refresh results (nil - SystemClock)
+	Clock Clock
+
+	// refreshes - result of last generate or refresh of point
+	refreshes map[K]HubRefreshResult
+	// keysRefresh - result of last load of keys list
+	keysRefresh HubRefreshResult
+
 	mx sync.Mutex
 }
 
+// HubRefreshResult - time and error of last refresh
+type HubRefreshResult struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
+// HubPointStats - key of point and result of its last generate or refresh
+type HubPointStats struct {
+	Key         string           `json:"key"`
+	Exists      bool             `json:"exists"`
+	LastRefresh HubRefreshResult `json:"last_refresh"`
+}
+
+// HubStats - snapshot of hub points
+type HubStats struct {
+	Points     []HubPointStats  `json:"points"`
+	KeysLoaded HubRefreshResult `json:"keys_loaded"`
+}
+
+func (hub *Hub[K, T]) makeRefreshResultInternal(err error) HubRefreshResult {
+	res := HubRefreshResult{Time: clockOrSystem(hub.Clock).Now()}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
 func MakeHub[K comparable, T any](
 	ctxBase context.Context,
 	pointsKeysList PointsKeysListFunc[K],
@@ -33,7 +73,8 @@ func MakeHub[K comparable, T any](
 	pointRefresh PointRefreshFunc[K, T],
 ) *Hub[K, T] {
 	return &Hub[K, T]{
-		points: make(map[K]T),
+		points:    make(map[K]T),
+		refreshes: make(map[K]HubRefreshResult),
 
 		ctxBase: ctxBase,
 
@@ -57,6 +98,31 @@ func (hub *Hub[K, T]) GetInternal(key K) (point T, ok bool) {
 	return point, ok
 }
 
+// Stats - returns keys of points (sorted) with results of last refresh
+func (hub *Hub[K, T]) Stats() HubStats {
+	hub.mx.Lock()
+	defer hub.mx.Unlock()
+
+	res := HubStats{KeysLoaded: hub.keysRefresh}
+
+	for key, r := range hub.refreshes {
+		_, ok := hub.points[key]
+		res.Points = append(res.Points, HubPointStats{Key: fmt.Sprint(key), Exists: ok, LastRefresh: r})
+	}
+
+	sort.Slice(res.Points, func(i, j int) bool { return res.Points[i].Key < res.Points[j].Key })
+
+	return res
+}
+
+// Len - returns count of points
+func (hub *Hub[K, T]) Len() int {
+	hub.mx.Lock()
+	defer hub.mx.Unlock()
+
+	return len(hub.points)
+}
+
 func (hub *Hub[K, T]) Refresh() (err error) {
 	hub.mx.Lock()
 	defer hub.mx.Unlock()
@@ -69,7 +135,9 @@ func (hub *Hub[K, T]) refreshLoadInternal() (err error) {
 	defer func() { ctx.Complete(err) }()
 
 	keys, err := hub.pointsKeysList(hub.ctxBase)
+	hub.keysRefresh = hub.makeRefreshResultInternal(err)
 	if err != nil {
+		hub.metrics.addRefreshError(ctx)
 		return err
 	}
 
@@ -85,6 +153,12 @@ func (hub *Hub[K, T]) refreshLoadInternal() (err error) {
 		}
 	}
 
+	for key := range hub.refreshes {
+		if _, ok := hub.points[key]; !ok && !mkey[key] {
+			delete(hub.refreshes, key)
+		}
+	}
+
 	return nil
 }
 
@@ -95,10 +169,14 @@ func (hub *Hub[K, T]) refreshPoint(ctx *mfctx.Crumps, key K) (err error) {
 	ctx = ctx.With("key", key).Start("hub.refreshPointInternal")
 	defer func() { ctx.Complete(err) }()
 
+	defer func() { hub.refreshes[key] = hub.makeRefreshResultInternal(err) }()
+
 	point, ok := hub.points[key]
 	if !ok {
-		point, err := hub.pointGenerate(ctx, key)
+		var point T
+		point, err = hub.pointGenerate(ctx, key)
 		if err != nil {
+			hub.metrics.addRefreshError(ctx)
 			return err
 		}
 
@@ -108,6 +186,7 @@ func (hub *Hub[K, T]) refreshPoint(ctx *mfctx.Crumps, key K) (err error) {
 
 	err = hub.pointRefresh(ctx, key, point)
 	if err != nil {
+		hub.metrics.addRefreshError(ctx)
 		return err
 	}
 
@@ -120,6 +199,7 @@ func (hub *Hub[K, T]) destroy(ctx *mfctx.Crumps, key K) {
 	if ok {
 		delete(hub.points, key)
 	}
+	delete(hub.refreshes, key)
 	hub.mx.Unlock()
 
 	if ok {
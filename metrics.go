@@ -0,0 +1,241 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// MetricsNameAttr - attribute with name of pool or hub in metrics
+const MetricsNameAttr = "name"
+
+const (
+	MetricPoolOpen         = "poh.pool.connections.open"
+	MetricPoolIdle         = "poh.pool.connections.idle"
+	MetricPoolInUse        = "poh.pool.connections.in_use"
+	MetricPoolWaiters      = "poh.pool.waiters"
+	MetricPoolAcquireTime  = "poh.pool.acquire.duration"
+	MetricPoolHoldTime     = "poh.pool.hold.duration"
+	MetricPoolCreates      = "poh.pool.connections.created"
+	MetricPoolTerminations = "poh.pool.connections.terminated"
+	MetricPoolOverflows    = "poh.pool.overflows"
+	MetricPoolCreateErrors = "poh.pool.create.errors"
+	MetricHubPoints        = "poh.hub.points"
+	MetricHubRefreshErrors = "poh.hub.refresh.errors"
+	metricUnitSeconds      = "s"
+	metricUnitConnections  = "{connection}"
+	metricUnitWaiters      = "{waiter}"
+	metricUnitPoints       = "{point}"
+	metricUnitErrors       = "{error}"
+	metricUnitOverflows    = "{overflow}"
+	metricUnitTerminations = "{termination}"
+)
+
+// connectionPoolMetrics - otel instruments of connection pool; nil means metrics are disabled
+type connectionPoolMetrics struct {
+	attrs metric.MeasurementOption
+
+	acquireTime  metric.Float64Histogram
+	holdTime     metric.Float64Histogram
+	creates      metric.Int64Counter
+	terminations metric.Int64Counter
+	overflows    metric.Int64Counter
+	createErrors metric.Int64Counter
+
+	reg metric.Registration
+}
+
+// EnableMetrics - registers otel instruments of pool in meter; name is set as MetricsNameAttr attribute
+func (cp *ConnectionPool[T]) EnableMetrics(meter metric.Meter, name string) (err error) {
+	m := &connectionPoolMetrics{
+		attrs: metric.WithAttributes(attribute.String(MetricsNameAttr, name)),
+	}
+
+	open, errO := meter.Int64ObservableGauge(MetricPoolOpen, metric.WithUnit(metricUnitConnections),
+		metric.WithDescription("Count of open connections in pool"))
+	idle, errI := meter.Int64ObservableGauge(MetricPoolIdle, metric.WithUnit(metricUnitConnections),
+		metric.WithDescription("Count of idle connections in pool"))
+	inUse, errU := meter.Int64ObservableGauge(MetricPoolInUse, metric.WithUnit(metricUnitConnections),
+		metric.WithDescription("Count of connections in use"))
+	waiters, errW := meter.Int64ObservableGauge(MetricPoolWaiters, metric.WithUnit(metricUnitWaiters),
+		metric.WithDescription("Count of callers waiting for connection"))
+
+	err = errors.Join(errO, errI, errU, errW)
+	if err != nil {
+		return err
+	}
+
+	m.acquireTime, errO = meter.Float64Histogram(MetricPoolAcquireTime, metric.WithUnit(metricUnitSeconds),
+		metric.WithDescription("Time spent to get connection from pool"))
+	m.holdTime, errI = meter.Float64Histogram(MetricPoolHoldTime, metric.WithUnit(metricUnitSeconds),
+		metric.WithDescription("Time connection was held by caller"))
+	m.creates, errU = meter.Int64Counter(MetricPoolCreates, metric.WithUnit(metricUnitConnections),
+		metric.WithDescription("Count of created connections"))
+	m.terminations, errW = meter.Int64Counter(MetricPoolTerminations, metric.WithUnit(metricUnitTerminations),
+		metric.WithDescription("Count of connections removed from pool"))
+
+	err = errors.Join(errO, errI, errU, errW)
+	if err != nil {
+		return err
+	}
+
+	m.overflows, errO = meter.Int64Counter(MetricPoolOverflows, metric.WithUnit(metricUnitOverflows),
+		metric.WithDescription("Count of get calls rejected by MaxCount"))
+	m.createErrors, errI = meter.Int64Counter(MetricPoolCreateErrors, metric.WithUnit(metricUnitErrors),
+		metric.WithDescription("Count of connection generation errors"))
+
+	err = errors.Join(errO, errI)
+	if err != nil {
+		return err
+	}
+
+	m.reg, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		s := cp.Stats()
+		o.ObserveInt64(open, int64(s.OpenConnections), m.attrs)
+		o.ObserveInt64(idle, int64(s.Idle), m.attrs)
+		o.ObserveInt64(inUse, int64(s.InUse), m.attrs)
+		o.ObserveInt64(waiters, int64(s.Waiters), m.attrs)
+		return nil
+	}, open, idle, inUse, waiters)
+	if err != nil {
+		return err
+	}
+
+	cp.mx.Lock()
+	defer cp.mx.Unlock()
+
+	if cp.metrics != nil {
+		cp.metrics.reg.Unregister()
+	}
+	cp.metrics = m
+
+	return nil
+}
+
+// DisableMetrics - unregisters otel instruments of pool
+func (cp *ConnectionPool[T]) DisableMetrics() (err error) {
+	cp.mx.Lock()
+	defer cp.mx.Unlock()
+
+	if cp.metrics == nil {
+		return nil
+	}
+
+	err = cp.metrics.reg.Unregister()
+	cp.metrics = nil
+
+	return err
+}
+
+func (m *connectionPoolMetrics) recordAcquire(ctx context.Context, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.acquireTime.Record(ctx, d.Seconds(), m.attrs)
+}
+
+func (m *connectionPoolMetrics) recordHold(ctx context.Context, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.holdTime.Record(ctx, d.Seconds(), m.attrs)
+}
+
+func (m *connectionPoolMetrics) addCreate(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	m.creates.Add(ctx, 1, m.attrs)
+}
+
+func (m *connectionPoolMetrics) addTermination(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	m.terminations.Add(ctx, 1, m.attrs)
+}
+
+func (m *connectionPoolMetrics) addOverflow(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	m.overflows.Add(ctx, 1, m.attrs)
+}
+
+func (m *connectionPoolMetrics) addCreateError(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	m.createErrors.Add(ctx, 1, m.attrs)
+}
+
+// hubMetrics - otel instruments of hub; nil means metrics are disabled
+type hubMetrics struct {
+	attrs metric.MeasurementOption
+
+	refreshErrors metric.Int64Counter
+
+	reg metric.Registration
+}
+
+// EnableMetrics - registers otel instruments of hub in meter; name is set as MetricsNameAttr attribute
+func (hub *Hub[K, T]) EnableMetrics(meter metric.Meter, name string) (err error) {
+	m := &hubMetrics{
+		attrs: metric.WithAttributes(attribute.String(MetricsNameAttr, name)),
+	}
+
+	points, err := meter.Int64ObservableGauge(MetricHubPoints, metric.WithUnit(metricUnitPoints),
+		metric.WithDescription("Count of points in hub"))
+	if err != nil {
+		return err
+	}
+
+	m.refreshErrors, err = meter.Int64Counter(MetricHubRefreshErrors, metric.WithUnit(metricUnitErrors),
+		metric.WithDescription("Count of hub keys list, point generate and refresh errors"))
+	if err != nil {
+		return err
+	}
+
+	m.reg, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveInt64(points, int64(hub.Len()), m.attrs)
+		return nil
+	}, points)
+	if err != nil {
+		return err
+	}
+
+	hub.mx.Lock()
+	defer hub.mx.Unlock()
+
+	if hub.metrics != nil {
+		hub.metrics.reg.Unregister()
+	}
+	hub.metrics = m
+
+	return nil
+}
+
+// DisableMetrics - unregisters otel instruments of hub
+func (hub *Hub[K, T]) DisableMetrics() (err error) {
+	hub.mx.Lock()
+	defer hub.mx.Unlock()
+
+	if hub.metrics == nil {
+		return nil
+	}
+
+	err = hub.metrics.reg.Unregister()
+	hub.metrics = nil
+
+	return err
+}
+
+func (m *hubMetrics) addRefreshError(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	m.refreshErrors.Add(ctx, 1, m.attrs)
+}
@@ -0,0 +1,138 @@
+package poh
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/myfantasy/mfctx"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func collectMetrics(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	err := reader.Collect(context.Background(), &rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			res[m.Name] = m.Data
+		}
+	}
+
+	return res
+}
+
+func metricInt(t *testing.T, ms map[string]metricdata.Aggregation, name string) int64 {
+	switch d := ms[name].(type) {
+	case metricdata.Gauge[int64]:
+		return d.DataPoints[0].Value
+	case metricdata.Sum[int64]:
+		return d.DataPoints[0].Value
+	}
+	t.Fatalf("metric `%v` not found or has unexpected type %T", name, ms[name])
+	return 0
+}
+
+func TestConnectionPoolMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cp := makeTestWaitPool(2)
+	err := cp.EnableMetrics(provider.Meter("poh"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, free1, _ := cp.Get(context.Background())
+	_, free2, _ := cp.Get(context.Background())
+	_, _, err = cp.Get(context.Background())
+	if err == nil {
+		t.Fatal("overflow error expected")
+	}
+	free1()
+
+	ms := collectMetrics(t, reader)
+
+	if v := metricInt(t, ms, MetricPoolOpen); v != 2 {
+		t.Errorf("open should be 2 but `%v`", v)
+	}
+	if v := metricInt(t, ms, MetricPoolIdle); v != 1 {
+		t.Errorf("idle should be 1 but `%v`", v)
+	}
+	if v := metricInt(t, ms, MetricPoolInUse); v != 1 {
+		t.Errorf("in use should be 1 but `%v`", v)
+	}
+	if v := metricInt(t, ms, MetricPoolCreates); v != 2 {
+		t.Errorf("creates should be 2 but `%v`", v)
+	}
+	if v := metricInt(t, ms, MetricPoolOverflows); v != 1 {
+		t.Errorf("overflows should be 1 but `%v`", v)
+	}
+
+	acquire, ok := ms[MetricPoolAcquireTime].(metricdata.Histogram[float64])
+	if !ok || acquire.DataPoints[0].Count != 2 {
+		t.Errorf("acquire histogram should have 2 records: %v", ToJson(ms[MetricPoolAcquireTime]))
+	}
+	hold, ok := ms[MetricPoolHoldTime].(metricdata.Histogram[float64])
+	if !ok || hold.DataPoints[0].Count != 1 {
+		t.Errorf("hold histogram should have 1 record: %v", ToJson(ms[MetricPoolHoldTime]))
+	}
+
+	free2()
+
+	err = cp.DisableMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms = collectMetrics(t, reader)
+	if g, ok := ms[MetricPoolOpen].(metricdata.Gauge[int64]); ok && len(g.DataPoints) != 0 {
+		t.Errorf("open gauge should not be observed after disable: %v", ToJson(g))
+	}
+}
+
+func TestHubMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	hub := MakeHub[string, struct{}](
+		context.Background(),
+		func(ctx context.Context) (keys []string, err error) {
+			return []string{"a", "b"}, nil
+		},
+		func(ctx context.Context, key string, point struct{}) (err error) {
+			return nil
+		},
+		func(ctx context.Context, key string) (point struct{}, err error) {
+			if key == "b" {
+				return point, fmt.Errorf("test generate error")
+			}
+			return struct{}{}, nil
+		},
+		func(ctx context.Context, key string, point struct{}) (err error) {
+			return nil
+		},
+	)
+
+	err := hub.EnableMetrics(provider.Meter("poh"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub.refreshPoint(mfctx.FromCtx(context.Background()), "a")
+	hub.refreshPoint(mfctx.FromCtx(context.Background()), "b")
+
+	ms := collectMetrics(t, reader)
+
+	if v := metricInt(t, ms, MetricHubPoints); v != 1 {
+		t.Errorf("points should be 1 but `%v`", v)
+	}
+	if v := metricInt(t, ms, MetricHubRefreshErrors); v != 1 {
+		t.Errorf("refresh errors should be 1 but `%v`", v)
+	}
+}
@@ -0,0 +1,326 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/myfantasy/mfctx"
+)
+
+const DefaultEjectThreshold = 3
+const DefaultEjectCoolDown = 5 * time.Second
+const DefaultEjectCoolDownMax = time.Minute
+
+const EndpointLogParam = "endpoint"
+
+// Endpoint - address of replica with weight (used by BalanceWeighted; 0 means 1)
+type Endpoint struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// EndpointDialFunc - generates connection to endpoint
+type EndpointDialFunc[T any] func(ctxBase context.Context, endpoint Endpoint) (*Connection[T], error)
+
+type BalanceStrategy int
+
+const (
+	// BalanceRoundRobin - endpoints are used in turn
+	BalanceRoundRobin BalanceStrategy = iota
+	// BalanceLeastConnections - endpoint with less open connections is used
+	BalanceLeastConnections
+	// BalanceWeighted - endpoints are used in turn proportionally to weight (smooth weighted round robin)
+	BalanceWeighted
+)
+
+// EndpointStats - snapshot of endpoint state
+type EndpointStats struct {
+	Endpoint
+	Connections int                 `json:"connections"`
+	Ejected     bool                `json:"ejected"`
+	Breaker     CircuitBreakerStats `json:"breaker"`
+}
+
+type endpointState struct {
+	Endpoint
+
+	// breaker - ejects endpoint after failed generations or validations
+	breaker *CircuitBreaker
+	conns   int
+	// dialing - count of connections being dialed (counted by BalanceLeastConnections)
+	dialing int
+	// current - current weight of smooth weighted round robin
+	current int
+}
+
+// MultiPool - ConnectionPool with connections to many endpoints;
+// endpoint of new connection is chosen by Strategy, endpoint with EjectThreshold consecutive failed generations
+// or validations is ejected for cool-down from EjectCoolDown (doubled on repeated failures up to EjectCoolDownMax)
+type MultiPool[T any] struct {
+	*ConnectionPool[T]
+
+	Dial     EndpointDialFunc[T]
+	Strategy BalanceStrategy
+
+	// EjectThreshold, EjectCoolDown, EjectCoolDownMax - settings of endpoints added by SetEndpoints
+	EjectThreshold   int
+	EjectCoolDown    time.Duration
+	EjectCoolDownMax time.Duration
+
+	endpoints []*endpointState
+	// connEndpoint - endpoint of connection by connection id
+	connEndpoint map[string]*endpointState
+	next         int
+
+	mx sync.Mutex
+}
+
+func MakeMultiPool[T any](ctxBase context.Context,
+	ctxClose context.CancelCauseFunc,
+	dial EndpointDialFunc[T],
+	endpoints []Endpoint,
+	strategy BalanceStrategy,
+	maxCount CountFunc,
+	minCount CountFunc,
+) *MultiPool[T] {
+	mp := &MultiPool[T]{
+		Dial:     dial,
+		Strategy: strategy,
+
+		EjectThreshold:   DefaultEjectThreshold,
+		EjectCoolDown:    DefaultEjectCoolDown,
+		EjectCoolDownMax: DefaultEjectCoolDownMax,
+
+		connEndpoint: make(map[string]*endpointState),
+	}
+
+	mp.ConnectionPool = MakeConnectionPool(ctxBase, ctxClose, mp.generate, maxCount, minCount)
+	mp.ConnectionPool.onDrop = mp.dropped
+	mp.SetEndpoints(endpoints)
+
+	return mp
+}
+
+// SetEndpoints - replaces list of endpoints; connections to removed endpoints are terminated
+// (used ones on release) and idle connections over weighted share of endpoint are closed
+// so pool reopens them to new endpoints
+func (mp *MultiPool[T]) SetEndpoints(endpoints []Endpoint) {
+	mp.mx.Lock()
+
+	old := make(map[string]*endpointState, len(mp.endpoints))
+	for _, ep := range mp.endpoints {
+		old[ep.Name] = ep
+	}
+
+	mp.endpoints = make([]*endpointState, 0, len(endpoints))
+	for _, e := range endpoints {
+		ep, ok := old[e.Name]
+		if ok {
+			ep.Endpoint = e
+			delete(old, e.Name)
+		} else {
+			ep = &endpointState{
+				Endpoint: e,
+				breaker:  MakeCircuitBreaker(mp.EjectThreshold, mp.EjectCoolDown, mp.EjectCoolDownMax),
+			}
+			ep.breaker.Clock = mp.ConnectionPool.Clock
+			ep.breaker.Jitter = 0
+		}
+		mp.endpoints = append(mp.endpoints, ep)
+	}
+
+	surplus := mp.surplusInternal()
+
+	mp.mx.Unlock()
+
+	mp.ConnectionPool.Evict(func(c *Connection[T]) bool {
+		// pred runs with pool lock and pool lock is taken before mp.mx (see dropped), so mp.mx is not held here
+		mp.mx.Lock()
+		ep, ok := mp.connEndpoint[c.ID]
+		mp.mx.Unlock()
+
+		if !ok {
+			return false
+		}
+		if _, removed := old[ep.Name]; removed {
+			return true
+		}
+		if surplus[ep] > 0 && !c.CheckInUse() {
+			surplus[ep]--
+			return true
+		}
+		return false
+	}, ErrEndpointRemovedCP)
+}
+
+// SetClock - sets Clock of pool, its Reaper and endpoint breakers
+func (mp *MultiPool[T]) SetClock(clock Clock) {
+	mp.ConnectionPool.SetClock(clock)
+
+	mp.mx.Lock()
+	defer mp.mx.Unlock()
+
+	for _, ep := range mp.endpoints {
+		ep.breaker.mx.Lock()
+		ep.breaker.Clock = clock
+		ep.breaker.mx.Unlock()
+	}
+}
+
+// surplusInternal - count of connections of endpoints over their weighted share; without lock
+func (mp *MultiPool[T]) surplusInternal() map[*endpointState]int {
+	// connections of removed endpoints are reopened to the rest
+	total := len(mp.connEndpoint)
+	weights := 0
+	for _, ep := range mp.endpoints {
+		weights += ep.weight()
+	}
+
+	res := make(map[*endpointState]int)
+	if weights == 0 {
+		return res
+	}
+
+	for _, ep := range mp.endpoints {
+		share := (total*ep.weight() + weights - 1) / weights
+		if ep.conns > share {
+			res[ep] = ep.conns - share
+		}
+	}
+
+	return res
+}
+
+func (ep *endpointState) weight() int {
+	return max(ep.Weight, 1)
+}
+
+// Endpoints - returns snapshot of endpoints state
+func (mp *MultiPool[T]) Endpoints() []EndpointStats {
+	mp.mx.Lock()
+	defer mp.mx.Unlock()
+
+	res := make([]EndpointStats, 0, len(mp.endpoints))
+	for _, ep := range mp.endpoints {
+		bs := ep.breaker.Stats()
+		res = append(res, EndpointStats{
+			Endpoint:    ep.Endpoint,
+			Connections: ep.conns,
+			Ejected:     bs.State == BreakerOpen.String(),
+			Breaker:     bs,
+		})
+	}
+
+	return res
+}
+
+// pickInternal - returns allowed endpoint by strategy and counts dial to it (generate uncounts it); without lock
+func (mp *MultiPool[T]) pickInternal() (*endpointState, error) {
+	if len(mp.endpoints) == 0 {
+		return nil, ErrNoEndpointCP
+	}
+
+	candidates := make([]*endpointState, 0, len(mp.endpoints))
+
+	switch mp.Strategy {
+	case BalanceLeastConnections:
+		candidates = append(candidates, mp.endpoints...)
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].conns+candidates[i].dialing < candidates[j].conns+candidates[j].dialing
+		})
+	case BalanceWeighted:
+		// smooth weighted round robin: the heaviest current weight goes first
+		for _, ep := range mp.endpoints {
+			ep.current += ep.weight()
+		}
+		candidates = append(candidates, mp.endpoints...)
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].current > candidates[j].current })
+	default:
+		for i := range mp.endpoints {
+			candidates = append(candidates, mp.endpoints[(mp.next+i)%len(mp.endpoints)])
+		}
+		mp.next++
+	}
+
+	for _, ep := range candidates {
+		if ep.breaker.Allow() != nil {
+			continue
+		}
+
+		if mp.Strategy == BalanceWeighted {
+			for _, e := range mp.endpoints {
+				ep.current -= e.weight()
+			}
+		}
+
+		ep.dialing++
+
+		return ep, nil
+	}
+
+	return nil, ErrNoEndpointCP
+}
+
+// generate - ConnectionGenerator of pool; dials endpoint chosen by strategy
+func (mp *MultiPool[T]) generate(ctxBase context.Context) (conn *Connection[T], err error) {
+	mp.mx.Lock()
+	ep, err := mp.pickInternal()
+	mp.mx.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := mfctx.FromCtx(ctxBase).Start("poh.MultiPool.generate")
+	ctx.With(EndpointLogParam, ep.Name)
+	defer func() { ctx.Complete(err) }()
+
+	conn, err = mp.Dial(ctxBase, ep.Endpoint)
+	if err != nil {
+		if ctxBase.Err() != nil {
+			ep.breaker.Cancel()
+		} else {
+			ep.breaker.Failure()
+		}
+
+		mp.mx.Lock()
+		ep.dialing--
+		mp.mx.Unlock()
+
+		return nil, err
+	}
+	ep.breaker.Success()
+
+	mp.mx.Lock()
+	ep.dialing--
+	ep.conns++
+	mp.connEndpoint[conn.ID] = ep
+	mp.mx.Unlock()
+
+	return conn, nil
+}
+
+// dropped - forgets connection dropped by pool even its termination fails (pool does not retry it);
+// failed validation or keepalive counts as endpoint failure
+func (mp *MultiPool[T]) dropped(c *Connection[T]) {
+	var lastError error
+	c.LockDo(func() { lastError = c.LastError })
+
+	mp.mx.Lock()
+	defer mp.mx.Unlock()
+
+	ep, ok := mp.connEndpoint[c.ID]
+	if !ok {
+		return
+	}
+
+	if errors.Is(lastError, ErrConnectionValidationCP) || errors.Is(lastError, ErrConnectionKeepaliveCP) {
+		ep.breaker.Failure()
+	}
+
+	ep.conns--
+	delete(mp.connEndpoint, c.ID)
+}
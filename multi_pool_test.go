@@ -0,0 +1,320 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
+)
+
+func makeTestMultiPool(strategy BalanceStrategy, failing map[string]bool, endpoints ...Endpoint) *MultiPool[string] {
+	return MakeMultiPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context, endpoint Endpoint) (*Connection[string], error) {
+			if failing[endpoint.Name] {
+				return nil, fmt.Errorf("test dial error")
+			}
+			return MakeConnection(endpoint.Name,
+				func(ctx context.Context, conn string) error { return nil },
+				nil,
+				nil,
+			), nil
+		},
+		endpoints,
+		strategy,
+		func() int { return 100 },
+		nil,
+	)
+}
+
+func getEndpoints(t *testing.T, mp *MultiPool[string], n int) (res []string, frees []FreeConnectionFunc) {
+	for i := 0; i < n; i++ {
+		conn, free, err := mp.Get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, conn.Conn)
+		frees = append(frees, free)
+	}
+	return res, frees
+}
+
+func endpointConnections(mp *MultiPool[string]) map[string]int {
+	res := make(map[string]int)
+	for _, s := range mp.Endpoints() {
+		res[s.Name] = s.Connections
+	}
+	return res
+}
+
+func TestMultiPoolRoundRobin(t *testing.T) {
+	mp := makeTestMultiPool(BalanceRoundRobin, nil, Endpoint{Name: "a"}, Endpoint{Name: "b"}, Endpoint{Name: "c"})
+
+	res, _ := getEndpoints(t, mp, 4)
+	if fmt.Sprint(res) != "[a b c a]" {
+		t.Errorf("endpoints should be used in turn but `%v`", res)
+	}
+}
+
+func TestMultiPoolLeastConnections(t *testing.T) {
+	mp := makeTestMultiPool(BalanceLeastConnections, nil, Endpoint{Name: "a"}, Endpoint{Name: "b"})
+
+	res, _ := getEndpoints(t, mp, 3)
+	if fmt.Sprint(res) != "[a b a]" {
+		t.Errorf("endpoint with less connections should be used but `%v`", res)
+	}
+
+	mp.SetEndpoints([]Endpoint{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+
+	res, _ = getEndpoints(t, mp, 1)
+	if res[0] != "c" {
+		t.Errorf("new endpoint should be used but `%v`", res[0])
+	}
+}
+
+func TestMultiPoolLeastConnectionsDialing(t *testing.T) {
+	dialed := make(chan string, 3)
+	release := make(chan struct{})
+	mp := MakeMultiPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context, endpoint Endpoint) (*Connection[string], error) {
+			dialed <- endpoint.Name
+			<-release
+			if endpoint.Name == "c" {
+				return nil, fmt.Errorf("test dial error")
+			}
+			return MakeConnection(endpoint.Name,
+				func(ctx context.Context, conn string) error { return nil },
+				nil,
+				nil,
+			), nil
+		},
+		[]Endpoint{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+		BalanceLeastConnections,
+		func() int { return 100 },
+		nil,
+	)
+
+	done := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, _, err := mp.Get(context.Background())
+			done <- err
+		}()
+	}
+
+	names := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		names[<-dialed] = true
+	}
+	if len(names) != 3 {
+		t.Errorf("dialing connections should be counted but `%v`", names)
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+
+	mp.mx.Lock()
+	for _, ep := range mp.endpoints {
+		if ep.dialing != 0 {
+			t.Errorf("dialing of %v should be 0 but `%v`", ep.Name, ep.dialing)
+		}
+	}
+	mp.mx.Unlock()
+
+	if fmt.Sprint(endpointConnections(mp)) != "map[a:1 b:1 c:0]" {
+		t.Errorf("failed dial should not be counted: %v", endpointConnections(mp))
+	}
+}
+
+func TestMultiPoolWeighted(t *testing.T) {
+	mp := makeTestMultiPool(BalanceWeighted, nil, Endpoint{Name: "a", Weight: 2}, Endpoint{Name: "b", Weight: 1})
+
+	res, _ := getEndpoints(t, mp, 6)
+	if fmt.Sprint(res) != "[a b a a b a]" {
+		t.Errorf("endpoints should be used by weight but `%v`", res)
+	}
+}
+
+func TestMultiPoolEject(t *testing.T) {
+	failing := map[string]bool{"b": true}
+	mp := makeTestMultiPool(BalanceRoundRobin, failing)
+	mp.EjectThreshold = 2
+	mp.EjectCoolDown = time.Second
+	clock := fakeclock.New(time.Time{})
+	mp.SetClock(clock)
+	mp.SetEndpoints([]Endpoint{{Name: "a"}, {Name: "b"}})
+
+	errs := 0
+	var res []string
+	for i := 0; i < 6; i++ {
+		conn, _, err := mp.Get(context.Background())
+		if err != nil {
+			errs++
+			continue
+		}
+		res = append(res, conn.Conn)
+	}
+	if errs != 2 {
+		t.Errorf("endpoint should be ejected after 2 errors but `%v` errors", errs)
+	}
+	if fmt.Sprint(res) != "[a a a a]" {
+		t.Errorf("only healthy endpoint should be used but `%v`", res)
+	}
+
+	stats := mp.Endpoints()
+	if !stats[1].Ejected {
+		t.Errorf("endpoint should be ejected: %v", ToJson(stats[1]))
+	}
+
+	delete(failing, "b")
+	clock.Advance(time.Second)
+
+	res, _ = getEndpoints(t, mp, 2)
+	if fmt.Sprint(res) != "[a b]" && fmt.Sprint(res) != "[b a]" {
+		t.Errorf("endpoint should return after cool-down but `%v`", res)
+	}
+	if mp.Endpoints()[1].Ejected {
+		t.Errorf("endpoint should not be ejected after successful probe")
+	}
+
+	mp.SetEndpoints([]Endpoint{{Name: "a"}})
+	_, _, err := mp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing["a"] = true
+	mp.SetEndpoints([]Endpoint{{Name: "c"}})
+	failing["c"] = true
+	_, _, err = mp.Get(context.Background())
+	if err == nil {
+		t.Fatal("dial error expected")
+	}
+	_, _, err = mp.Get(context.Background())
+	if err == nil {
+		t.Fatal("dial error expected")
+	}
+	_, _, err = mp.Get(context.Background())
+	if !errors.Is(err, ErrNoEndpointCP) {
+		t.Errorf("no endpoint error expected but `%v`", err)
+	}
+}
+
+func TestMultiPoolSetEndpoints(t *testing.T) {
+	mp := makeTestMultiPool(BalanceRoundRobin, nil, Endpoint{Name: "a"}, Endpoint{Name: "b"})
+
+	res, frees := getEndpoints(t, mp, 4)
+	if fmt.Sprint(res) != "[a b a b]" {
+		t.Fatalf("endpoints should be used in turn but `%v`", res)
+	}
+	// a, b idle; a, b in use
+	frees[0]()
+	frees[1]()
+
+	mp.SetEndpoints([]Endpoint{{Name: "a"}, {Name: "c"}})
+
+	if cnt := endpointConnections(mp); cnt["a"] != 2 || cnt["c"] != 0 {
+		t.Errorf("connections of endpoints should be a:2 c:0 but `%v`", cnt)
+	}
+	if s := mp.Stats(); s.OpenConnections != 3 {
+		t.Errorf("idle connection of removed endpoint should be closed but open `%v`", s.OpenConnections)
+	}
+
+	frees[3]()
+	if s := mp.Stats(); s.OpenConnections != 2 {
+		t.Errorf("used connection of removed endpoint should be closed on release but open `%v`", s.OpenConnections)
+	}
+
+	// a has more than its share: idle connection is closed to be reopened to c
+	mp.SetEndpoints([]Endpoint{{Name: "a"}, {Name: "c"}})
+	if cnt := endpointConnections(mp); cnt["a"] != 1 {
+		t.Errorf("idle surplus of endpoint should be closed but `%v`", cnt)
+	}
+
+	res, _ = getEndpoints(t, mp, 2)
+	if cnt := endpointConnections(mp); cnt["a"] != 2 || cnt["c"] != 1 {
+		t.Errorf("connections of endpoints should be a:2 c:1 but `%v` (%v)", cnt, res)
+	}
+}
+
+func TestMultiPoolEjectOnValidation(t *testing.T) {
+	mp := makeTestMultiPool(BalanceRoundRobin, nil)
+	mp.EjectThreshold = 1
+	mp.SetEndpoints([]Endpoint{{Name: "a"}, {Name: "b"}})
+	mp.ValidateConnection = func(ctx context.Context, conn string) error {
+		if conn == "b" {
+			return fmt.Errorf("test validation error")
+		}
+		return nil
+	}
+
+	_, frees := getEndpoints(t, mp, 2)
+	frees[0]()
+	frees[1]()
+
+	// idle b fails validation and b is ejected, so only a is used
+	res, _ := getEndpoints(t, mp, 3)
+	if fmt.Sprint(res) != "[a a a]" {
+		t.Errorf("endpoint should be ejected after failed validation but `%v`", res)
+	}
+	if !mp.Endpoints()[1].Ejected {
+		t.Errorf("endpoint should be ejected: %v", ToJson(mp.Endpoints()))
+	}
+}
+
+func TestMultiPoolTerminateFailed(t *testing.T) {
+	mp := MakeMultiPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context, endpoint Endpoint) (*Connection[string], error) {
+			return MakeConnection(endpoint.Name,
+				func(ctx context.Context, conn string) error { return fmt.Errorf("test terminate error") },
+				nil,
+				func() time.Duration { return time.Second },
+			), nil
+		},
+		[]Endpoint{{Name: "a"}},
+		BalanceRoundRobin,
+		func() int { return 100 },
+		nil,
+	)
+	clock := fakeclock.New(time.Time{})
+	mp.SetClock(clock)
+	mp.Reaper = nil
+
+	for i := 0; i < 5; i++ {
+		conn, free, err := mp.Get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.MarkBroken(fmt.Errorf("test broken"))
+		free()
+	}
+
+	if s := mp.Stats(); s.OpenConnections != 0 || s.TerminateErrors != 5 {
+		t.Errorf("broken connections should be removed: %v", ToJson(s))
+	}
+	if cnt := endpointConnections(mp); cnt["a"] != 0 || len(mp.connEndpoint) != 0 {
+		t.Errorf("removed connections should be forgotten even termination fails but `%v`", cnt)
+	}
+
+	_, free, _ := mp.Get(context.Background())
+	free()
+	clock.Advance(time.Hour)
+	mp.ClearAndOpenJobStep()
+
+	// idle expired connection failed to close stays in pool and its close is retried
+	if s := mp.Stats(); s.OpenConnections != 1 || s.TerminateErrors != 6 {
+		t.Errorf("connection failed to close should stay in pool: %v", ToJson(s))
+	}
+	if cnt := endpointConnections(mp); cnt["a"] != 1 {
+		t.Errorf("connection in pool should be counted but `%v`", cnt)
+	}
+}
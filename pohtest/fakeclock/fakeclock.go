@@ -0,0 +1,136 @@
+// Package fakeclock - clock for tests that moves only by Advance (implements poh.Clock)
+package fakeclock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock - fake clock; timers fire in Advance and Set (in goroutine of caller, without lock)
+type Clock struct {
+	now    time.Time
+	timers []*timer
+	seq    int64
+
+	mx   sync.Mutex
+	cond *sync.Cond
+}
+
+type timer struct {
+	at  time.Time
+	seq int64
+	f   func()
+}
+
+// New - makes fake clock with now time (zero now means current time)
+func New(now time.Time) *Clock {
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mx)
+
+	return c
+}
+
+// Now - returns current fake time
+func (c *Clock) Now() time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.now
+}
+
+// AfterFunc - runs f when time is advanced by d (timer with d <= 0 fires on next Advance); stop removes timer
+// and returns false when timer fired or stopped already
+func (c *Clock) AfterFunc(d time.Duration, f func()) (stop func() bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.seq++
+	t := &timer{at: c.now.Add(d), seq: c.seq, f: f}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+
+	return func() bool {
+		c.mx.Lock()
+		defer c.mx.Unlock()
+
+		return c.removeInternal(t)
+	}
+}
+
+// Sleep - blocks until time is advanced by d
+func (c *Clock) Sleep(d time.Duration) {
+	ch := make(chan struct{})
+	c.AfterFunc(d, func() { close(ch) })
+	<-ch
+}
+
+// Advance - moves time by d and fires due timers in order of their time
+func (c *Clock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set - moves time to now (time never goes back) and fires due timers in order of their time;
+// timers added by fired functions are fired too when they are due
+func (c *Clock) Set(now time.Time) {
+	for {
+		c.mx.Lock()
+
+		sort.Slice(c.timers, func(i, j int) bool {
+			if c.timers[i].at.Equal(c.timers[j].at) {
+				return c.timers[i].seq < c.timers[j].seq
+			}
+			return c.timers[i].at.Before(c.timers[j].at)
+		})
+
+		if len(c.timers) == 0 || c.timers[0].at.After(now) {
+			if now.After(c.now) {
+				c.now = now
+			}
+			c.mx.Unlock()
+			return
+		}
+
+		t := c.timers[0]
+		c.removeInternal(t)
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+
+		c.mx.Unlock()
+
+		t.f()
+	}
+}
+
+// Timers - returns count of not fired timers
+func (c *Clock) Timers() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return len(c.timers)
+}
+
+// WaitTimers - blocks until count of not fired timers is n or more (goroutines under test are sleeping)
+func (c *Clock) WaitTimers(n int) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *Clock) removeInternal(t *timer) bool {
+	for i, v := range c.timers {
+		if v == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
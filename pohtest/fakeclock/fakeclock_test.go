@@ -0,0 +1,53 @@
+package fakeclock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockAdvance(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New(start)
+
+	var fired []int
+	c.AfterFunc(2*time.Second, func() { fired = append(fired, 2) })
+	c.AfterFunc(time.Second, func() {
+		fired = append(fired, 1)
+		c.AfterFunc(time.Second, func() { fired = append(fired, 3) })
+	})
+	stop := c.AfterFunc(time.Second, func() { fired = append(fired, 0) })
+
+	if !stop() || stop() {
+		t.Error("stop should return true only first time")
+	}
+
+	c.Advance(500 * time.Millisecond)
+	if len(fired) != 0 {
+		t.Fatalf("timers should not fire: %v", fired)
+	}
+
+	c.Advance(5 * time.Second)
+	if len(fired) != 3 || fired[0] != 1 || fired[1] != 2 || fired[2] != 3 {
+		t.Errorf("wrong order of timers: %v", fired)
+	}
+	if !c.Now().Equal(start.Add(5500 * time.Millisecond)) {
+		t.Errorf("wrong now `%v`", c.Now())
+	}
+	if c.Timers() != 0 {
+		t.Errorf("all timers should fire")
+	}
+}
+
+func TestClockSleep(t *testing.T) {
+	c := New(time.Time{})
+
+	done := make(chan struct{})
+	go func() {
+		c.Sleep(time.Minute)
+		close(done)
+	}()
+
+	c.WaitTimers(1)
+	c.Advance(time.Minute)
+	<-done
+}
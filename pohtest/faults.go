@@ -0,0 +1,159 @@
+// Package pohtest - test kit for code using poh: fake resource, fault-injecting generators and leak assertions
+package pohtest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/myfantasy/poh"
+)
+
+var ErrInjected = fmt.Errorf("pohtest injected fault")
+
+// Faults - configuration of injected faults; rates are probabilities from 0 to 1
+type Faults struct {
+	// Latency - delay of every call
+	Latency time.Duration
+	// FailRate - rate of calls failed with ErrInjected
+	FailRate float64
+	// HangRate - rate of calls that hang until ctx is done
+	HangRate float64
+	// TerminateErrRate - rate of terminations failed with ErrInjected
+	TerminateErrRate float64
+
+	// Clock - clock of Latency (nil - poh.SystemClock)
+	Clock poh.Clock
+
+	rnd *rand.Rand
+	mx  sync.Mutex
+}
+
+// MakeFaults - makes faults with deterministic random source
+func MakeFaults(seed int64) *Faults {
+	return &Faults{
+		rnd: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Set - changes faults config with lock (use it while faults are in use)
+func (f *Faults) Set(fn func(f *Faults)) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	fn(f)
+}
+
+func (f *Faults) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if f.rnd == nil {
+		f.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return f.rnd.Float64() < rate
+}
+
+// Inject - waits Latency, hangs until ctx is done or fails by config
+func (f *Faults) Inject(ctx context.Context) error {
+	f.mx.Lock()
+	latency := f.Latency
+	clock := f.Clock
+	hang := f.hit(f.HangRate)
+	fail := f.hit(f.FailRate)
+	f.mx.Unlock()
+
+	if clock == nil {
+		clock = poh.SystemClock
+	}
+
+	if latency > 0 {
+		ch := make(chan struct{})
+		stop := clock.AfterFunc(latency, func() { close(ch) })
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			stop()
+			return context.Cause(ctx)
+		}
+	}
+
+	if hang {
+		<-ctx.Done()
+		return context.Cause(ctx)
+	}
+
+	if fail {
+		return ErrInjected
+	}
+
+	return nil
+}
+
+// InjectTerminate - fails termination by TerminateErrRate
+func (f *Faults) InjectTerminate() error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if f.hit(f.TerminateErrRate) {
+		return ErrInjected
+	}
+
+	return nil
+}
+
+// WrapGenerator - injects faults before gen
+func WrapGenerator[T any](f *Faults, gen poh.ConnectionGeneratorFunc[T]) poh.ConnectionGeneratorFunc[T] {
+	return func(ctxBase context.Context) (*poh.Connection[T], error) {
+		err := f.Inject(ctxBase)
+		if err != nil {
+			return nil, err
+		}
+		return gen(ctxBase)
+	}
+}
+
+// WrapTerminate - injects terminate errors before term (term is not called when error is injected)
+func WrapTerminate[T any](f *Faults, term poh.TermimateConnectionFunc[T]) poh.TermimateConnectionFunc[T] {
+	return func(ctx context.Context, conn T) error {
+		err := f.InjectTerminate()
+		if err != nil {
+			return err
+		}
+		return term(ctx, conn)
+	}
+}
+
+// WrapPointGenerate - injects faults before hub point generation
+func WrapPointGenerate[K comparable, T any](f *Faults, gen poh.PointGenerateFunc[K, T]) poh.PointGenerateFunc[K, T] {
+	return func(ctx context.Context, key K) (point T, err error) {
+		err = f.Inject(ctx)
+		if err != nil {
+			return point, err
+		}
+		return gen(ctx, key)
+	}
+}
+
+// WrapPointRefresh - injects faults before hub point refresh
+func WrapPointRefresh[K comparable, T any](f *Faults, refresh poh.PointRefreshFunc[K, T]) poh.PointRefreshFunc[K, T] {
+	return func(ctx context.Context, key K, point T) error {
+		err := f.Inject(ctx)
+		if err != nil {
+			return err
+		}
+		return refresh(ctx, key, point)
+	}
+}
+
+// WrapPointDestroy - injects terminate errors before hub point destroy
+func WrapPointDestroy[K comparable, T any](f *Faults, destroy poh.PointDestroyFunc[K, T]) poh.PointDestroyFunc[K, T] {
+	return func(ctx context.Context, key K, point T) error {
+		err := f.InjectTerminate()
+		if err != nil {
+			return err
+		}
+		return destroy(ctx, key, point)
+	}
+}
@@ -0,0 +1,86 @@
+package pohtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
+)
+
+func TestFaultsInject(t *testing.T) {
+	f := MakeFaults(1)
+	f.FailRate = 0.5
+
+	failed := 0
+	for i := 0; i < 1000; i++ {
+		if errors.Is(f.Inject(context.Background()), ErrInjected) {
+			failed++
+		}
+	}
+	if failed < 400 || failed > 600 {
+		t.Errorf("about half of calls should fail but `%v`", failed)
+	}
+
+	f.Set(func(f *Faults) {
+		f.FailRate = 0
+		f.HangRate = 1
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := f.Inject(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("hang should end by ctx but `%v`", err)
+	}
+}
+
+func TestFaultsLatency(t *testing.T) {
+	clock := fakeclock.New(time.Time{})
+	f := MakeFaults(1)
+	f.Latency = time.Second
+	f.Clock = clock
+
+	done := make(chan error)
+	go func() { done <- f.Inject(context.Background()) }()
+
+	clock.WaitTimers(1)
+	clock.Advance(time.Second)
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	g := MakeGenerator(nil)
+
+	c1, err := g.Generate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, _ := g.Generate(context.Background())
+
+	err = c1.Terminate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1.Conn.Use() == nil || c2.Conn.Use() != nil {
+		t.Errorf("only terminated resource should be closed")
+	}
+
+	if open := g.Open(); len(open) != 1 || open[0] != c2.Conn.ID {
+		t.Errorf("resource 2 should be open but `%v`", open)
+	}
+
+	g.Faults.TerminateErrRate = 1
+	if err := c2.Terminate(context.Background()); !errors.Is(err, ErrInjected) {
+		t.Errorf("terminate error should be injected but `%v`", err)
+	}
+	g.Faults.TerminateErrRate = 0
+	c2.Terminate(context.Background())
+
+	g.AssertNoLeaks(t)
+	if created, terminated := g.Counts(); created != 2 || terminated != 2 {
+		t.Errorf("wrong counts `%v` `%v`", created, terminated)
+	}
+}
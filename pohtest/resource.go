@@ -0,0 +1,158 @@
+package pohtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/poh"
+)
+
+var ErrResourceClosed = fmt.Errorf("pohtest resource is closed")
+
+// Resource - fake connection
+type Resource struct {
+	ID int
+
+	closed bool
+	mx     sync.Mutex
+}
+
+// Use - returns ErrResourceClosed when resource is closed
+func (r *Resource) Use() error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if r.closed {
+		return ErrResourceClosed
+	}
+	return nil
+}
+
+// IsClosed - resource is terminated
+func (r *Resource) IsClosed() bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	return r.closed
+}
+
+// Generator - generates Resource connections with injected faults and tracks not terminated ones
+type Generator struct {
+	Faults *Faults
+
+	OpenExpire poh.ExpireDurationFunc
+	IdleExpire poh.ExpireDurationFunc
+
+	seq  int
+	open map[int]*Resource
+
+	created    int
+	terminated int
+
+	mx sync.Mutex
+}
+
+// MakeGenerator - makes generator; nil faults means no faults
+func MakeGenerator(faults *Faults) *Generator {
+	if faults == nil {
+		faults = MakeFaults(0)
+	}
+	return &Generator{
+		Faults: faults,
+		open:   make(map[int]*Resource),
+	}
+}
+
+// Generate - ConnectionGeneratorFunc of Resource
+func (g *Generator) Generate(ctxBase context.Context) (*poh.Connection[*Resource], error) {
+	err := g.Faults.Inject(ctxBase)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	g.seq++
+	g.created++
+	r := &Resource{ID: g.seq}
+	g.open[r.ID] = r
+
+	return poh.MakeConnection(r, g.Terminate, g.OpenExpire, g.IdleExpire), nil
+}
+
+// Terminate - TermimateConnectionFunc of Resource
+func (g *Generator) Terminate(ctx context.Context, r *Resource) error {
+	err := g.Faults.InjectTerminate()
+	if err != nil {
+		return err
+	}
+
+	r.mx.Lock()
+	r.closed = true
+	r.mx.Unlock()
+
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	if _, ok := g.open[r.ID]; ok {
+		delete(g.open, r.ID)
+		g.terminated++
+	}
+
+	return nil
+}
+
+// Open - returns ids of generated not terminated resources
+func (g *Generator) Open() []int {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	res := make([]int, 0, len(g.open))
+	for id := range g.open {
+		res = append(res, id)
+	}
+	sort.Ints(res)
+
+	return res
+}
+
+// Counts - returns count of created and terminated resources
+func (g *Generator) Counts() (created int, terminated int) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	return g.created, g.terminated
+}
+
+// AssertNoLeaks - fails test when generated resources are not terminated
+func (g *Generator) AssertNoLeaks(t testing.TB) {
+	t.Helper()
+
+	if open := g.Open(); len(open) > 0 {
+		t.Errorf("pohtest: %v resources are not terminated: %v", len(open), open)
+	}
+}
+
+// AssertPoolIdle - fails test when connections of pool are still in use or waiters wait
+// (waits up to timeout for background releases)
+func AssertPoolIdle[T any](t testing.TB, cp *poh.ConnectionPool[T], timeout time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		s := cp.Stats()
+		if s.InUse == 0 && s.Waiters == 0 && s.Creating == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("pohtest: pool is not idle: in use %v, waiters %v, creating %v", s.InUse, s.Waiters, s.Creating)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,80 @@
+package poh
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter - token bucket limit of connection creations; one RateLimiter may be shared by many pools
+type RateLimiter struct {
+	// Rate - tokens per second
+	Rate float64
+	// Burst - max count of tokens (creations at once after idle time)
+	Burst int
+	// Clock - source of time (nil - SystemClock)
+	Clock Clock
+
+	tokens float64
+	last   time.Time
+
+	mx sync.Mutex
+}
+
+// MakeRateLimiter - makes full bucket of burst tokens refilled with rate tokens per second
+func MakeRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		Rate:   rate,
+		Burst:  burst,
+		tokens: float64(max(burst, 1)),
+	}
+}
+
+// Allow - takes token when it is available
+func (l *RateLimiter) Allow() bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	l.refillInternal()
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+
+	return true
+}
+
+// Cancel - returns token taken by Allow that was not used
+func (l *RateLimiter) Cancel() {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	l.refillInternal()
+	l.tokens = math.Min(l.tokens+1, float64(max(l.Burst, 1)))
+}
+
+// Delay - returns time until next token is available
+func (l *RateLimiter) Delay() time.Duration {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	l.refillInternal()
+
+	if l.tokens >= 1 {
+		return 0
+	}
+	if l.Rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(math.Ceil((1 - l.tokens) / l.Rate * float64(time.Second)))
+}
+
+func (l *RateLimiter) refillInternal() {
+	now := clockOrSystem(l.Clock).Now()
+	if !l.last.IsZero() && l.Rate > 0 {
+		l.tokens = math.Min(l.tokens+now.Sub(l.last).Seconds()*l.Rate, float64(max(l.Burst, 1)))
+	}
+	l.last = now
+}
@@ -0,0 +1,95 @@
+package poh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clock := fakeclock.New(time.Time{})
+	l := MakeRateLimiter(10, 2)
+	l.Clock = clock
+
+	if !l.Allow() || !l.Allow() {
+		t.Fatal("burst should be allowed")
+	}
+	if l.Allow() {
+		t.Fatal("call over burst should be limited")
+	}
+	if d := l.Delay(); d != 100*time.Millisecond {
+		t.Errorf("delay should be 100ms but `%v`", d)
+	}
+
+	clock.Advance(50 * time.Millisecond)
+	if l.Allow() {
+		t.Fatal("half of token should not be allowed")
+	}
+
+	clock.Advance(50 * time.Millisecond)
+	if !l.Allow() {
+		t.Fatal("token should be refilled")
+	}
+
+	l.Cancel()
+	if !l.Allow() {
+		t.Fatal("canceled token should be returned")
+	}
+
+	clock.Advance(time.Hour)
+	if !l.Allow() || !l.Allow() || l.Allow() {
+		t.Error("tokens should be limited by burst")
+	}
+}
+
+func TestConnectionPoolRateLimit(t *testing.T) {
+	clock := fakeclock.New(time.Time{})
+	limit := MakeRateLimiter(1, 1)
+	limit.Clock = clock
+
+	cp1 := makeTestWaitPool(10)
+	cp1.SetClock(clock)
+	cp1.RateLimit = limit
+	cp2 := makeTestWaitPool(10)
+	cp2.SetClock(clock)
+	cp2.RateLimit = limit
+
+	_, free, err := cp1.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer free()
+
+	// limiter is shared by pools
+	_, _, err = cp2.Get(context.Background())
+	if !errors.Is(err, ErrRateLimitCP) {
+		t.Fatalf("rate limit error expected but `%v`", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, f, err := cp1.GetWait(context.Background())
+		if err == nil {
+			f()
+		}
+		done <- err
+	}()
+	waitWaitersCount(t, cp1, 1)
+
+	clock.Advance(500 * time.Millisecond)
+	if cp1.WaitersCount() != 1 {
+		t.Fatal("waiter should wait for token")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if s := cp1.Stats(); s.RateLimited == 0 || s.OpenConnections != 2 {
+		t.Errorf("wrong pool stats: %v", ToJson(s))
+	}
+}
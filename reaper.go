@@ -0,0 +1,175 @@
+package poh
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// Reaper - single timer scheduler of expiration checks; one Reaper may be shared by many pools
+// it runs no goroutine while nothing is due and stops when its context is done
+type Reaper struct {
+	ctx context.Context
+
+	items reaperHeap
+	keys  map[string]*reaperItem
+	// stopTimer - stops timer of nearest item
+	stopTimer func() bool
+	clock     Clock
+
+	mx sync.Mutex
+}
+
+type reaperItem struct {
+	key   string
+	at    time.Time
+	ctx   context.Context
+	fn    func()
+	index int
+}
+
+type reaperHeap []*reaperItem
+
+func (h reaperHeap) Len() int           { return len(h) }
+func (h reaperHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h reaperHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *reaperHeap) Push(x any) {
+	item := x.(*reaperItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+func (h *reaperHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	item.index = -1
+	return item
+}
+
+func MakeReaper(ctx context.Context) *Reaper {
+	r := &Reaper{
+		ctx:  ctx,
+		keys: make(map[string]*reaperItem),
+	}
+
+	context.AfterFunc(ctx, r.stop)
+
+	return r
+}
+
+// SetClock - sets source of time and timers (nil - SystemClock)
+func (r *Reaper) SetClock(clock Clock) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	r.clock = clock
+	if r.ctx.Err() == nil {
+		r.resetTimerInternal()
+	}
+}
+
+// Schedule - runs fn at time at; fn is skipped when ctx is done;
+// scheduling existing key replaces its time and fn
+func (r *Reaper) Schedule(ctx context.Context, key string, at time.Time, fn func()) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if r.ctx.Err() != nil || ctx.Err() != nil {
+		return
+	}
+
+	item, ok := r.keys[key]
+	if ok {
+		item.at = at
+		item.ctx = ctx
+		item.fn = fn
+		heap.Fix(&r.items, item.index)
+	} else {
+		item = &reaperItem{key: key, at: at, ctx: ctx, fn: fn}
+		heap.Push(&r.items, item)
+		r.keys[key] = item
+	}
+
+	r.resetTimerInternal()
+}
+
+// Cancel - removes scheduled key
+func (r *Reaper) Cancel(key string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	item, ok := r.keys[key]
+	if !ok {
+		return
+	}
+
+	heap.Remove(&r.items, item.index)
+	delete(r.keys, key)
+
+	r.resetTimerInternal()
+}
+
+// Len - returns count of scheduled keys
+func (r *Reaper) Len() int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	return len(r.items)
+}
+
+func (r *Reaper) resetTimerInternal() {
+	if r.stopTimer != nil {
+		r.stopTimer()
+		r.stopTimer = nil
+	}
+
+	if len(r.items) == 0 {
+		return
+	}
+
+	clock := clockOrSystem(r.clock)
+	r.stopTimer = clock.AfterFunc(r.items[0].at.Sub(clock.Now()), r.fire)
+}
+
+func (r *Reaper) fire() {
+	r.mx.Lock()
+
+	var due []*reaperItem
+	now := clockOrSystem(r.clock).Now()
+	for len(r.items) > 0 && !r.items[0].at.After(now) {
+		item := heap.Pop(&r.items).(*reaperItem)
+		delete(r.keys, item.key)
+		due = append(due, item)
+	}
+
+	if r.ctx.Err() == nil {
+		r.resetTimerInternal()
+	}
+
+	r.mx.Unlock()
+
+	for _, item := range due {
+		if item.ctx.Err() == nil {
+			item.fn()
+		}
+	}
+}
+
+func (r *Reaper) stop() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if r.stopTimer != nil {
+		r.stopTimer()
+		r.stopTimer = nil
+	}
+	r.items = nil
+	r.keys = make(map[string]*reaperItem)
+}
@@ -0,0 +1,63 @@
+package poh
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReaper(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := MakeReaper(ctx)
+
+	var mx sync.Mutex
+	var fired []string
+	add := func(key string) func() {
+		return func() {
+			mx.Lock()
+			defer mx.Unlock()
+			fired = append(fired, key)
+		}
+	}
+
+	now := time.Now()
+	r.Schedule(ctx, "c", now.Add(6*time.Millisecond), add("c"))
+	r.Schedule(ctx, "a", now.Add(2*time.Millisecond), add("a"))
+	r.Schedule(ctx, "b", now.Add(time.Hour), add("b"))
+	r.Schedule(ctx, "d", now.Add(4*time.Millisecond), add("d"))
+
+	// reschedule replaces time
+	r.Schedule(ctx, "b", now.Add(4*time.Millisecond), add("b"))
+	r.Cancel("d")
+
+	ctxItem, cancelItem := context.WithCancel(context.Background())
+	r.Schedule(ctxItem, "e", now.Add(time.Millisecond), add("e"))
+	cancelItem()
+
+	if r.Len() != 4 {
+		t.Errorf("scheduled should be 4 but `%v`", r.Len())
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	mx.Lock()
+	if ToJson(fired) != ToJson([]string{"a", "b", "c"}) {
+		t.Errorf("fired should be [a b c] but `%v`", fired)
+	}
+	mx.Unlock()
+
+	if r.Len() != 0 {
+		t.Errorf("scheduled should be 0 but `%v`", r.Len())
+	}
+
+	cancel()
+	time.Sleep(time.Millisecond)
+
+	r.Schedule(context.Background(), "f", time.Now(), add("f"))
+	if r.Len() != 0 {
+		t.Errorf("stopped reaper should not schedule but `%v`", r.Len())
+	}
+}
@@ -0,0 +1,225 @@
+package poh
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/myfantasy/mfctx"
+)
+
+const DefaultRouterLagCheckTimeout = time.Second
+
+const ReplicaLogParam = "replica"
+
+// ReplicaLagFunc - returns replication lag of replica (pool may be used to query it)
+type ReplicaLagFunc[T any] func(ctx context.Context, name string, pool *ConnectionPool[T]) (lag time.Duration, err error)
+
+// RouterReplicaStats - snapshot of replica state
+type RouterReplicaStats struct {
+	Name     string              `json:"name"`
+	Lag      time.Duration       `json:"lag"`
+	LagError string              `json:"lag_error,omitempty"`
+	Stale    bool                `json:"stale"`
+	Pool     ConnectionPoolStats `json:"pool"`
+}
+
+// RouterStats - snapshot of router state
+type RouterStats struct {
+	Primary  ConnectionPoolStats  `json:"primary"`
+	Replicas []RouterReplicaStats `json:"replicas"`
+	// Fallbacks - count of reads served by primary because no replica was available
+	Fallbacks int64 `json:"fallbacks"`
+}
+
+type routerReplica[T any] struct {
+	name string
+	pool *ConnectionPool[T]
+
+	lag    time.Duration
+	lagErr error
+	// stale - replica is excluded from reads by lag check
+	stale bool
+}
+
+// Router - read-write split over pool of primary and pools of replicas;
+// writes go to primary, reads go to replicas in turn with fallback to primary
+// when no replica is available or all replicas are stale
+type Router[T any] struct {
+	Primary *ConnectionPool[T]
+
+	// Lag - when set replicas with lag more than MaxLag or failed lag check are excluded from reads
+	Lag    ReplicaLagFunc[T]
+	MaxLag time.Duration
+	// LagCheckTimeout - period of lag checks in LagJobRun
+	LagCheckTimeout time.Duration
+	// Clock - source of time and timers of LagJobRun (nil - SystemClock)
+	Clock Clock
+
+	ctxBase context.Context
+
+	replicas  []*routerReplica[T]
+	next      int
+	fallbacks int64
+
+	mx sync.Mutex
+}
+
+func MakeRouter[T any](ctxBase context.Context, primary *ConnectionPool[T]) *Router[T] {
+	return &Router[T]{
+		Primary:         primary,
+		LagCheckTimeout: DefaultRouterLagCheckTimeout,
+
+		ctxBase: ctxBase,
+	}
+}
+
+// AddReplica - adds pool of replica (replaces pool of replica with same name)
+func (r *Router[T]) AddReplica(name string, pool *ConnectionPool[T]) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	for _, rp := range r.replicas {
+		if rp.name == name {
+			rp.pool = pool
+			return
+		}
+	}
+
+	r.replicas = append(r.replicas, &routerReplica[T]{name: name, pool: pool})
+}
+
+// RemoveReplica - removes replica from router; pool of replica is not closed
+func (r *Router[T]) RemoveReplica(name string) (pool *ConnectionPool[T], ok bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	for i, rp := range r.replicas {
+		if rp.name == name {
+			r.replicas = append(r.replicas[:i], r.replicas[i+1:]...)
+			return rp.pool, true
+		}
+	}
+
+	return nil, false
+}
+
+// GetWrite - gets connection of primary (waits when primary pool is overflowed)
+func (r *Router[T]) GetWrite(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.Router.GetWrite")
+	defer func() { ctx.Complete(err) }()
+
+	return r.Primary.GetWait(ctxIn)
+}
+
+// GetRead - gets connection of not stale replica in turn without waiting;
+// when no replica gives connection it waits for connection of primary
+func (r *Router[T]) GetRead(ctxIn context.Context) (conn *Connection[T], free FreeConnectionFunc, err error) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.Router.GetRead")
+	defer func() { ctx.Complete(err) }()
+
+	for _, rp := range r.readReplicas() {
+		conn, free, err = rp.pool.Get(ctxIn)
+		if err == nil {
+			ctx.With(ReplicaLogParam, rp.name)
+			return conn, free, nil
+		}
+		if ctxIn.Err() != nil {
+			return nil, freeConnectionFuncEmpty, ctxIn.Err()
+		}
+	}
+
+	r.mx.Lock()
+	r.fallbacks++
+	r.mx.Unlock()
+
+	return r.Primary.GetWait(ctxIn)
+}
+
+// readReplicas - copies of not stale replicas starting from next in turn
+func (r *Router[T]) readReplicas() []routerReplica[T] {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	res := make([]routerReplica[T], 0, len(r.replicas))
+	for i := range r.replicas {
+		rp := r.replicas[(r.next+i)%len(r.replicas)]
+		if !rp.stale {
+			res = append(res, *rp)
+		}
+	}
+	r.next++
+
+	return res
+}
+
+// CheckLag - checks lag of all replicas by Lag and marks stale ones
+func (r *Router[T]) CheckLag(ctxIn context.Context) {
+	ctx := mfctx.FromCtx(ctxIn).Start("poh.Router.CheckLag")
+	defer func() { ctx.Complete(nil) }()
+
+	r.mx.Lock()
+	lagF := r.Lag
+	maxLag := r.MaxLag
+	replicas := append([]*routerReplica[T](nil), r.replicas...)
+	r.mx.Unlock()
+
+	for _, rp := range replicas {
+		r.mx.Lock()
+		pool := rp.pool
+		r.mx.Unlock()
+
+		var lag time.Duration
+		var err error
+		if lagF != nil {
+			lag, err = lagF(ctxIn, rp.name, pool)
+		}
+
+		r.mx.Lock()
+		rp.lag = lag
+		rp.lagErr = err
+		rp.stale = err != nil || maxLag > 0 && lag > maxLag
+		r.mx.Unlock()
+	}
+}
+
+// LagJobRun - runs CheckLag every LagCheckTimeout until ctxBase is done
+func (r *Router[T]) LagJobRun() {
+	go func() {
+		for r.ctxBase.Err() == nil {
+			r.CheckLag(r.ctxBase)
+			sleepClock(r.ctxBase, r.Clock, r.LagCheckTimeout)
+		}
+	}()
+}
+
+// Stats - returns snapshot of router state
+func (r *Router[T]) Stats() RouterStats {
+	r.mx.Lock()
+	res := RouterStats{
+		Replicas:  make([]RouterReplicaStats, 0, len(r.replicas)),
+		Fallbacks: r.fallbacks,
+	}
+	pools := make([]*ConnectionPool[T], 0, len(r.replicas))
+	for _, rp := range r.replicas {
+		pools = append(pools, rp.pool)
+		s := RouterReplicaStats{
+			Name:  rp.name,
+			Lag:   rp.lag,
+			Stale: rp.stale,
+		}
+		if rp.lagErr != nil {
+			s.LagError = rp.lagErr.Error()
+		}
+		res.Replicas = append(res.Replicas, s)
+	}
+	r.mx.Unlock()
+
+	// pool stats are taken without router lock
+	res.Primary = r.Primary.Stats()
+	for i, pool := range pools {
+		res.Replicas[i].Pool = pool.Stats()
+	}
+
+	return res
+}
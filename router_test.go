@@ -0,0 +1,177 @@
+package poh
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/myfantasy/poh/pohtest/fakeclock"
+)
+
+func makeTestNodePool(name string, maxCount int, fail bool) *ConnectionPool[string] {
+	return MakeConnectionPool(
+		context.Background(),
+		func(cause error) {},
+		func(ctxBase context.Context) (*Connection[string], error) {
+			if fail {
+				return nil, fmt.Errorf("test generate error")
+			}
+			return MakeConnection(name,
+				func(ctx context.Context, conn string) error { return nil },
+				nil,
+				nil,
+			), nil
+		},
+		func() int { return maxCount },
+		nil,
+	)
+}
+
+func getRead(t *testing.T, r *Router[string]) (string, FreeConnectionFunc) {
+	conn, free, err := r.GetRead(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn.Conn, free
+}
+
+func TestRouterReadWrite(t *testing.T) {
+	r := MakeRouter(context.Background(), makeTestNodePool("p", 10, false))
+	r.AddReplica("r1", makeTestNodePool("r1", 10, false))
+	r.AddReplica("r2", makeTestNodePool("r2", 10, false))
+
+	conn, free, err := r.GetWrite(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	free()
+	if conn.Conn != "p" {
+		t.Errorf("write should go to primary but `%v`", conn.Conn)
+	}
+
+	var res []string
+	for i := 0; i < 4; i++ {
+		name, free := getRead(t, r)
+		free()
+		res = append(res, name)
+	}
+	if fmt.Sprint(res) != "[r1 r2 r1 r2]" {
+		t.Errorf("reads should go to replicas in turn but `%v`", res)
+	}
+
+	if pool, ok := r.RemoveReplica("r1"); !ok || pool == nil {
+		t.Errorf("replica should be removed")
+	}
+	name, free := getRead(t, r)
+	free()
+	if name != "r2" {
+		t.Errorf("read should go to rest replica but `%v`", name)
+	}
+}
+
+func TestRouterFallback(t *testing.T) {
+	r := MakeRouter(context.Background(), makeTestNodePool("p", 10, false))
+	r.AddReplica("r1", makeTestNodePool("r1", 1, false))
+	r.AddReplica("r2", makeTestNodePool("r2", 10, true))
+
+	name, _ := getRead(t, r)
+	if name != "r1" {
+		t.Errorf("read should go to replica but `%v`", name)
+	}
+
+	// r1 is overflowed and r2 fails
+	name, free := getRead(t, r)
+	free()
+	if name != "p" {
+		t.Errorf("read should fall back to primary but `%v`", name)
+	}
+
+	if s := r.Stats(); s.Fallbacks != 1 || len(s.Replicas) != 2 || s.Replicas[0].Pool.InUse != 1 {
+		t.Errorf("unexpected stats: %v", ToJson(s))
+	}
+}
+
+func TestRouterLag(t *testing.T) {
+	r := MakeRouter(context.Background(), makeTestNodePool("p", 10, false))
+	r.AddReplica("r1", makeTestNodePool("r1", 10, false))
+	r.AddReplica("r2", makeTestNodePool("r2", 10, false))
+
+	var mx sync.Mutex
+	lags := map[string]time.Duration{"r1": 2 * time.Second, "r2": 0}
+	r.MaxLag = time.Second
+	r.Lag = func(ctx context.Context, name string, pool *ConnectionPool[string]) (time.Duration, error) {
+		mx.Lock()
+		defer mx.Unlock()
+
+		lag, ok := lags[name]
+		if !ok {
+			return 0, fmt.Errorf("test lag error")
+		}
+		return lag, nil
+	}
+
+	r.CheckLag(context.Background())
+
+	for i := 0; i < 2; i++ {
+		name, free := getRead(t, r)
+		free()
+		if name != "r2" {
+			t.Errorf("read should not go to stale replica but `%v`", name)
+		}
+	}
+
+	mx.Lock()
+	delete(lags, "r2")
+	mx.Unlock()
+	r.CheckLag(context.Background())
+
+	name, free := getRead(t, r)
+	free()
+	if name != "p" {
+		t.Errorf("read should fall back to primary when all replicas are stale but `%v`", name)
+	}
+
+	s := r.Stats()
+	if !s.Replicas[0].Stale || s.Replicas[0].Lag != 2*time.Second || !s.Replicas[1].Stale || s.Replicas[1].LagError == "" {
+		t.Errorf("unexpected stats: %v", ToJson(s))
+	}
+}
+
+func TestRouterLagJob(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := MakeRouter(ctx, makeTestNodePool("p", 10, false))
+	r.AddReplica("r1", makeTestNodePool("r1", 10, false))
+	clock := fakeclock.New(time.Time{})
+	r.Clock = clock
+	r.LagCheckTimeout = time.Second
+	r.MaxLag = time.Second
+
+	var mx sync.Mutex
+	lag := time.Duration(0)
+	r.Lag = func(ctx context.Context, name string, pool *ConnectionPool[string]) (time.Duration, error) {
+		mx.Lock()
+		defer mx.Unlock()
+		return lag, nil
+	}
+
+	r.LagJobRun()
+	clock.WaitTimers(1)
+
+	if r.Stats().Replicas[0].Stale {
+		t.Errorf("replica should not be stale")
+	}
+
+	mx.Lock()
+	lag = 2 * time.Second
+	mx.Unlock()
+	clock.Advance(time.Second)
+	clock.WaitTimers(1)
+
+	if !r.Stats().Replicas[0].Stale {
+		t.Errorf("replica should be stale after lag check")
+	}
+}
@@ -0,0 +1,334 @@
+package poh
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+)
+
+// SQLConnector - driver.Connector over pool of driver.Conn for use with database/sql;
+// Connect borrows connection from pool and Close of it returns connection to pool,
+// connection is terminated when its use returns driver.ErrBadConn or broken error (see IsBrokenErr);
+// idle connections should be kept by pool only, so sql.DB should not keep them (SetMaxIdleConns(0), see OpenSQLDB),
+// otherwise connections idle in sql.DB are in use for pool (they are not validated, expired or lent to other callers)
+type SQLConnector struct {
+	Pool *ConnectionPool[driver.Conn]
+	// DriverSQL - driver returned by Driver (nil - connector itself)
+	DriverSQL driver.Driver
+}
+
+func MakeSQLConnector(pool *ConnectionPool[driver.Conn]) *SQLConnector {
+	return &SQLConnector{
+		Pool: pool,
+	}
+}
+
+// OpenSQLDB - opens sql.DB over pool; idle connections of sql.DB are disabled so connection returns to pool
+// on release by sql.DB
+func OpenSQLDB(pool *ConnectionPool[driver.Conn]) *sql.DB {
+	db := sql.OpenDB(MakeSQLConnector(pool))
+	db.SetMaxIdleConns(0)
+
+	return db
+}
+
+// SQLConnectionGenerator - ConnectionGeneratorFunc that opens connections by connector and closes them on terminate
+func SQLConnectionGenerator(connector driver.Connector,
+	openExpire ExpireDurationFunc,
+	idleExpire ExpireDurationFunc,
+) ConnectionGeneratorFunc[driver.Conn] {
+	return func(ctxBase context.Context) (*Connection[driver.Conn], error) {
+		conn, err := connector.Connect(ctxBase)
+		if err != nil {
+			return nil, err
+		}
+
+		return MakeConnection(conn,
+			func(ctx context.Context, conn driver.Conn) error { return conn.Close() },
+			openExpire,
+			idleExpire,
+		), nil
+	}
+}
+
+// ValidateSQLConnection - ValidateConnectionFunc that pings connection when it implements driver.Pinger
+func ValidateSQLConnection(ctx context.Context, conn driver.Conn) error {
+	if p, ok := conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+
+	return nil
+}
+
+// Connect - borrows connection from pool (waits when pool is overflowed)
+func (sc *SQLConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, release, err := sc.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlConn{
+		pool:    sc.Pool,
+		conn:    conn,
+		release: release,
+	}, nil
+}
+
+// Driver - returns DriverSQL or connector itself
+func (sc *SQLConnector) Driver() driver.Driver {
+	if sc.DriverSQL != nil {
+		return sc.DriverSQL
+	}
+
+	return sc
+}
+
+// Open - borrows connection from pool; name is ignored
+func (sc *SQLConnector) Open(name string) (driver.Conn, error) {
+	return sc.Connect(context.Background())
+}
+
+// sqlConn - connection borrowed by database/sql; it remembers broken error to terminate connection on Close
+type sqlConn struct {
+	pool    *ConnectionPool[driver.Conn]
+	conn    *Connection[driver.Conn]
+	release ReleaseWithErrorFunc
+
+	broken error
+	closed bool
+
+	mx sync.Mutex
+}
+
+// check - remembers error that breaks connection
+func (c *sqlConn) check(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || c.pool.IsBrokenErr(err) {
+		c.mx.Lock()
+		if c.broken == nil {
+			c.broken = errors.Join(ErrBrokenConnection, err)
+		}
+		c.mx.Unlock()
+	}
+
+	return err
+}
+
+// Close - returns connection to pool
+func (c *sqlConn) Close() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	return c.release(c.broken)
+}
+
+// IsValid - implements driver.Validator; broken, reclaimed or terminated connection is not valid
+func (c *sqlConn) IsValid() bool {
+	c.mx.Lock()
+	broken := c.broken != nil
+	c.mx.Unlock()
+
+	if broken || c.conn.CheckBroken() || c.conn.CheckReclaimed() || c.conn.CheckIsTerminated() {
+		return false
+	}
+
+	if v, ok := c.conn.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+
+	return true
+}
+
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.conn.Conn.Prepare(query)
+	if err != nil {
+		return nil, c.check(err)
+	}
+
+	return &sqlStmt{Stmt: stmt, c: c}, nil
+}
+
+func (c *sqlConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.conn.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else if err = ctx.Err(); err == nil {
+		stmt, err = c.conn.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, c.check(err)
+	}
+
+	return &sqlStmt{Stmt: stmt, c: c}, nil
+}
+
+func (c *sqlConn) Begin() (driver.Tx, error) {
+	tx, err := c.conn.Conn.Begin()
+	if err != nil {
+		return nil, c.check(err)
+	}
+
+	return &sqlTx{Tx: tx, c: c}, nil
+}
+
+func (c *sqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	var err error
+	if b, ok := c.conn.Conn.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, ErrSQLIsolationLevel
+	} else if opts.ReadOnly {
+		return nil, ErrSQLReadOnly
+	} else if err = ctx.Err(); err == nil {
+		tx, err = c.conn.Conn.Begin()
+	}
+	if err != nil {
+		return nil, c.check(err)
+	}
+
+	return &sqlTx{Tx: tx, c: c}, nil
+}
+
+// ExecContext - implements driver.ExecerContext; driver.ErrSkip makes database/sql prepare statement
+func (c *sqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.conn.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	res, err := e.ExecContext(ctx, query, args)
+
+	return res, c.check(err)
+}
+
+// QueryContext - implements driver.QueryerContext; driver.ErrSkip makes database/sql prepare statement
+func (c *sqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.conn.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	rows, err := q.QueryContext(ctx, query, args)
+
+	return rows, c.check(err)
+}
+
+func (c *sqlConn) Ping(ctx context.Context) error {
+	return c.check(ValidateSQLConnection(ctx, c.conn.Conn))
+}
+
+func (c *sqlConn) ResetSession(ctx context.Context) error {
+	if !c.IsValid() {
+		return driver.ErrBadConn
+	}
+
+	if r, ok := c.conn.Conn.(driver.SessionResetter); ok {
+		return c.check(r.ResetSession(ctx))
+	}
+
+	return nil
+}
+
+func (c *sqlConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.conn.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+
+	return driver.ErrSkip
+}
+
+// sqlStmt - statement of sqlConn; it reports errors to connection
+type sqlStmt struct {
+	driver.Stmt
+	c *sqlConn
+}
+
+func (s *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	res, err := s.Stmt.Exec(args)
+	return res, s.c.check(err)
+}
+
+func (s *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.Stmt.Query(args)
+	return rows, s.c.check(err)
+}
+
+func (s *sqlStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err := e.ExecContext(ctx, args)
+		return res, s.c.check(err)
+	}
+
+	values, err := sqlValues(args)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.Exec(values)
+}
+
+func (s *sqlStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err := q.QueryContext(ctx, args)
+		return rows, s.c.check(err)
+	}
+
+	values, err := sqlValues(args)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.Query(values)
+}
+
+func (s *sqlStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+
+	return s.c.CheckNamedValue(nv)
+}
+
+func sqlValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, ErrSQLNamedParams
+		}
+		values[i] = arg.Value
+	}
+
+	return values, nil
+}
+
+// sqlTx - transaction of sqlConn; it reports errors to connection
+type sqlTx struct {
+	driver.Tx
+	c *sqlConn
+}
+
+func (t *sqlTx) Commit() error {
+	return t.c.check(t.Tx.Commit())
+}
+
+func (t *sqlTx) Rollback() error {
+	return t.c.check(t.Tx.Rollback())
+}
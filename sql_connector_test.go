@@ -0,0 +1,206 @@
+package poh
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSQL - in-memory key-value driver: `set` exec stores args[0]=args[1], `get` query returns value of args[0]
+type fakeSQL struct {
+	data   map[string]string
+	opened int
+	closed int
+	// bad - count of next execs failed by driver.ErrBadConn
+	bad int
+
+	mx sync.Mutex
+}
+
+type fakeSQLConn struct {
+	db *fakeSQL
+}
+
+type fakeSQLStmt struct {
+	conn  *fakeSQLConn
+	query string
+}
+
+type fakeSQLTx struct{}
+
+type fakeSQLRows struct {
+	values []string
+}
+
+func (f *fakeSQL) Connect(ctx context.Context) (driver.Conn, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.opened++
+	return &fakeSQLConn{db: f}, nil
+}
+
+func (f *fakeSQL) Driver() driver.Driver { return nil }
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeSQLConn) Close() error {
+	c.db.mx.Lock()
+	defer c.db.mx.Unlock()
+	c.db.closed++
+	return nil
+}
+
+func (c *fakeSQLConn) Begin() (driver.Tx, error) { return fakeSQLTx{}, nil }
+
+func (fakeSQLTx) Commit() error   { return nil }
+func (fakeSQLTx) Rollback() error { return nil }
+
+func (s *fakeSQLStmt) Close() error  { return nil }
+func (s *fakeSQLStmt) NumInput() int { return -1 }
+
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.conn.db
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	if db.bad > 0 {
+		db.bad--
+		return nil, driver.ErrBadConn
+	}
+	if s.query != "set" || len(args) != 2 {
+		return nil, fmt.Errorf("test unknown exec `%v`", s.query)
+	}
+	db.data[fmt.Sprint(args[0])] = fmt.Sprint(args[1])
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	db := s.conn.db
+	db.mx.Lock()
+	defer db.mx.Unlock()
+
+	if s.query != "get" || len(args) != 1 {
+		return nil, fmt.Errorf("test unknown query `%v`", s.query)
+	}
+	v, ok := db.data[fmt.Sprint(args[0])]
+	if !ok {
+		return &fakeSQLRows{}, nil
+	}
+
+	return &fakeSQLRows{values: []string{v}}, nil
+}
+
+func (r *fakeSQLRows) Columns() []string { return []string{"value"} }
+func (r *fakeSQLRows) Close() error      { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.values[0]
+	r.values = r.values[1:]
+	return nil
+}
+
+func (f *fakeSQL) counts() (opened int, closed int) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.opened, f.closed
+}
+
+func makeTestSQLDB() (*fakeSQL, *ConnectionPool[driver.Conn], *sql.DB) {
+	fake := &fakeSQL{data: make(map[string]string)}
+	cp := MakeConnectionPool(
+		context.Background(),
+		func(cause error) {},
+		SQLConnectionGenerator(fake, nil, nil),
+		func() int { return 2 },
+		nil,
+	)
+
+	return fake, cp, OpenSQLDB(cp)
+}
+
+func TestSQLConnector(t *testing.T) {
+	fake, cp, db := makeTestSQLDB()
+
+	_, err := db.Exec("set", "a", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Exec("set", "b", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v string
+	err = db.QueryRowContext(context.Background(), "get", "b").Scan(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "2" {
+		t.Errorf("value should be 2 but `%v`", v)
+	}
+
+	err = db.QueryRow("get", "c").Scan(&v)
+	if err != sql.ErrNoRows {
+		t.Errorf("no rows error expected but `%v`", err)
+	}
+
+	_, err = db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err == nil || !strings.Contains(err.Error(), ErrSQLReadOnly.Error()) {
+		t.Errorf("read-only error expected but `%v`", err)
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// database/sql closes its connections, pool keeps them
+	if opened, closed := fake.counts(); opened != 1 || closed != 0 {
+		t.Errorf("one connection should be opened and not closed but opened `%v` closed `%v`", opened, closed)
+	}
+	if s := cp.Stats(); s.OpenConnections != 1 || s.Idle != 1 {
+		t.Errorf("connection should be idle in pool: %v", ToJson(s))
+	}
+}
+
+func TestSQLConnectorBadConn(t *testing.T) {
+	fake, cp, db := makeTestSQLDB()
+	defer db.Close()
+
+	fake.mx.Lock()
+	fake.bad = 1
+	fake.mx.Unlock()
+
+	// database/sql retries on driver.ErrBadConn with another connection
+	_, err := db.Exec("set", "a", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if opened, closed := fake.counts(); opened != 2 || closed != 1 {
+		t.Errorf("bad connection should be terminated but opened `%v` closed `%v`", opened, closed)
+	}
+	if s := cp.Stats(); s.OpenConnections != 1 {
+		t.Errorf("only good connection should stay in pool: %v", ToJson(s))
+	}
+}